@@ -5,17 +5,26 @@ import (
 	"log"
 	"net/http"
 
+	"api/pkg/mail"
 	"api/pkg/routes"
+	"api/pkg/utils"
 
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 )
 
 func main() {
+	if err := utils.LoadSigningKeys(); err != nil {
+		log.Fatal(err)
+	}
+	if err := mail.CheckConfig(); err != nil {
+		log.Fatal(err)
+	}
+
 	r := mux.NewRouter()
 	routes.RegisterRoutes(r)
 	http.Handle("/", r)
 	fmt.Println("Listening on http://localhost:8080")
-	log.Fatal(http.ListenAndServe(":8080", handlers.CORS(handlers.AllowedHeaders([]string{"X-Requested-With", "Content-Type", "Authorization"}), handlers.AllowedMethods([]string{"GET", "POST", "PUT", "DELETE"}), handlers.AllowedOrigins([]string{"*"}))(r)))
+	log.Fatal(http.ListenAndServe(":8080", handlers.CORS(handlers.AllowedHeaders([]string{"X-Requested-With", "Content-Type", "Authorization", "X-API-Key", "If-Match", "If-None-Match"}), handlers.ExposedHeaders([]string{"ETag", "Retry-After"}), handlers.AllowedMethods([]string{"GET", "POST", "PUT", "PATCH", "DELETE"}), handlers.AllowedOrigins([]string{"*"}))(r)))
 
 }
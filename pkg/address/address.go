@@ -0,0 +1,153 @@
+package address
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Components is a US postal address split into its parts. Fields that could
+// not be determined are left empty.
+type Components struct {
+	Street string `json:"street"`
+	Unit   string `json:"unit"`
+	City   string `json:"city"`
+	State  string `json:"state"` // two-letter USPS code
+	Zip    string `json:"zip"`   // 5 digits, or ZIP+4 as 12345-6789
+	County string `json:"county"`
+}
+
+var (
+	zipPattern    = regexp.MustCompile(`\b(\d{5})(?:-(\d{4}))?$`)
+	countyPattern = regexp.MustCompile(`(?i)^(.+?)\s+(county|parish|borough)$`)
+
+	// A unit designator at the end of a street line: a whole keyword or "#",
+	// then a number such as "4B" or "B-12", or a single letter. Street names
+	// like "Lot Ln" or "Roomington" must not match.
+	unitPattern = regexp.MustCompile(`(?i)[\s,]+(?:(?:apt|apartment|unit|ste|suite|bldg|building|fl|floor|rm|room|lot|spc|space|trlr)\b\.?\s*#?\s*|#\s*)((?:[A-Z]{1,2}-?)?\d[A-Z0-9-]*|[A-Z])$`)
+)
+
+var stateCodes = map[string]string{
+	"alabama": "AL", "alaska": "AK", "arizona": "AZ", "arkansas": "AR", "california": "CA",
+	"colorado": "CO", "connecticut": "CT", "delaware": "DE", "district of columbia": "DC", "florida": "FL",
+	"georgia": "GA", "hawaii": "HI", "idaho": "ID", "illinois": "IL", "indiana": "IN",
+	"iowa": "IA", "kansas": "KS", "kentucky": "KY", "louisiana": "LA", "maine": "ME",
+	"maryland": "MD", "massachusetts": "MA", "michigan": "MI", "minnesota": "MN", "mississippi": "MS",
+	"missouri": "MO", "montana": "MT", "nebraska": "NE", "nevada": "NV", "new hampshire": "NH",
+	"new jersey": "NJ", "new mexico": "NM", "new york": "NY", "north carolina": "NC", "north dakota": "ND",
+	"ohio": "OH", "oklahoma": "OK", "oregon": "OR", "pennsylvania": "PA", "puerto rico": "PR",
+	"rhode island": "RI", "south carolina": "SC", "south dakota": "SD", "tennessee": "TN", "texas": "TX",
+	"utah": "UT", "vermont": "VT", "virginia": "VA", "washington": "WA", "west virginia": "WV",
+	"wisconsin": "WI", "wyoming": "WY",
+}
+
+// NormalizeState returns the two-letter code for a state name or code, or
+// an empty string when s is not a US state
+func NormalizeState(s string) string {
+	s = strings.ToLower(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(s), ".")))
+	if code, ok := stateCodes[s]; ok {
+		return code
+	}
+	if len(s) == 2 {
+		upper := strings.ToUpper(s)
+		for _, code := range stateCodes {
+			if code == upper {
+				return code
+			}
+		}
+	}
+	return ""
+}
+
+// Parse splits a free-form address such as
+// "4949 Corrado Ave Unit 2, Ave Maria, Collier County, FL 34142" into its
+// components. It is deliberately forgiving: anything it cannot place is
+// left empty rather than guessed.
+func Parse(raw string) Components {
+	var c Components
+
+	var parts []string
+	for _, part := range strings.Split(raw, ",") {
+		if part = strings.Join(strings.Fields(part), " "); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) == 0 {
+		return c
+	}
+
+	// Drop a trailing country
+	switch strings.ToLower(parts[len(parts)-1]) {
+	case "usa", "us", "u.s.a.", "u.s.", "united states", "united states of america":
+		parts = parts[:len(parts)-1]
+	}
+	if len(parts) == 0 {
+		return c
+	}
+
+	// The first part is the street line, possibly carrying the unit
+	c.Street, c.Unit = splitUnit(parts[0])
+	parts = parts[1:]
+
+	// The last part is usually "ST 12345", "State", or "City ST 12345" when
+	// the city was not comma separated
+	if len(parts) > 0 {
+		last := parts[len(parts)-1]
+		if m := zipPattern.FindStringSubmatchIndex(last); m != nil {
+			c.Zip = last[m[2]:m[3]]
+			if m[4] >= 0 {
+				c.Zip += "-" + last[m[4]:m[5]]
+			}
+			last = strings.TrimSpace(last[:m[0]])
+		}
+
+		if state := NormalizeState(last); state != "" {
+			c.State = state
+			parts = parts[:len(parts)-1]
+		} else if i := strings.LastIndex(last, " "); i > 0 && NormalizeState(last[i+1:]) != "" {
+			c.State = NormalizeState(last[i+1:])
+			parts[len(parts)-1] = last[:i]
+		} else if last == "" {
+			parts = parts[:len(parts)-1]
+		} else {
+			parts[len(parts)-1] = last
+		}
+	}
+
+	// Of what is left, a "... County" part is the county, a unit-looking part
+	// is the unit, and the last remaining part is the city
+	var rest []string
+	for _, part := range parts {
+		if m := countyPattern.FindStringSubmatch(part); m != nil && c.County == "" {
+			c.County = part
+			continue
+		}
+		if _, unit := splitUnit(", " + part); unit != "" && c.Unit == "" {
+			c.Unit = unit
+			continue
+		}
+		rest = append(rest, part)
+	}
+	if len(rest) > 0 {
+		c.City = rest[len(rest)-1]
+	}
+
+	return c
+}
+
+// splitUnit separates a trailing unit designator ("Apt 4B", "#12") from a
+// street line
+func splitUnit(street string) (string, string) {
+	m := unitPattern.FindStringSubmatchIndex(street)
+	if m == nil {
+		return strings.TrimPrefix(street, ", "), ""
+	}
+	return strings.TrimPrefix(strings.TrimSpace(street[:m[0]]), ", "), strings.ToUpper(street[m[2]:m[3]])
+}
+
+// StreetLine returns the street with its unit, as used on a mailing label
+func (c Components) StreetLine() string {
+	if c.Unit == "" {
+		return c.Street
+	}
+	return c.Street + " #" + c.Unit
+}
@@ -0,0 +1,102 @@
+package address
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want Components
+	}{
+		{
+			raw:  "4949 Corrado Ave Unit 2, Ave Maria, Collier County, FL 34142",
+			want: Components{Street: "4949 Corrado Ave", Unit: "2", City: "Ave Maria", State: "FL", Zip: "34142", County: "Collier County"},
+		},
+		{
+			raw:  "123 Main St Apt 4B, Springfield, IL 62704-1234, USA",
+			want: Components{Street: "123 Main St", Unit: "4B", City: "Springfield", State: "IL", Zip: "62704-1234"},
+		},
+		{
+			raw:  "500 Elm St, Suite 200, Austin, Texas",
+			want: Components{Street: "500 Elm St", Unit: "200", City: "Austin", State: "TX"},
+		},
+		{
+			raw:  "77 Ocean Dr #12, Miami Beach FL 33139",
+			want: Components{Street: "77 Ocean Dr", Unit: "12", City: "Miami Beach", State: "FL", Zip: "33139"},
+		},
+		{
+			raw:  "9 Lot Ln, Ste. Genevieve, MO 63670",
+			want: Components{Street: "9 Lot Ln", City: "Ste. Genevieve", State: "MO", Zip: "63670"},
+		},
+		{
+			raw:  "  ",
+			want: Components{},
+		},
+	}
+
+	for _, tt := range tests {
+		if got := Parse(tt.raw); got != tt.want {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestSplitUnit(t *testing.T) {
+	tests := []struct {
+		street, wantStreet, wantUnit string
+	}{
+		{"123 Main St Apt 4B", "123 Main St", "4B"},
+		{"123 Main St Apt. #4", "123 Main St", "4"},
+		{"123 Main St, Unit B", "123 Main St", "B"},
+		{"123 Main St # 7", "123 Main St", "7"},
+		{"123 Main St #A-12", "123 Main St", "A-12"},
+		{"10 Harbor Way Fl 3", "10 Harbor Way", "3"},
+		{"88 Trailer Park Rd Spc 14", "88 Trailer Park Rd", "14"},
+
+		// Street names that begin with or contain unit keywords
+		{"12 Roomington Ave", "12 Roomington Ave", ""},
+		{"12 Roomington", "12 Roomington", ""},
+		{"45 Flower St", "45 Flower St", ""},
+		{"300 Lot Lane", "300 Lot Lane", ""},
+		{"1 Space Center Blvd", "1 Space Center Blvd", ""},
+		{"7 Suite Rd", "7 Suite Rd", ""},
+		{"15 Unitas Ct", "15 Unitas Ct", ""},
+		{"123 Main St #", "123 Main St #", ""},
+		{"221B Baker St", "221B Baker St", ""},
+	}
+
+	for _, tt := range tests {
+		street, unit := splitUnit(tt.street)
+		if street != tt.wantStreet || unit != tt.wantUnit {
+			t.Errorf("splitUnit(%q) = %q, %q, want %q, %q", tt.street, street, unit, tt.wantStreet, tt.wantUnit)
+		}
+	}
+}
+
+func TestNormalizeState(t *testing.T) {
+	tests := map[string]string{
+		"FL":                   "FL",
+		"fl":                   "FL",
+		"Florida":              "FL",
+		"new york":             "NY",
+		"Tex.":                 "",
+		"XX":                   "",
+		"District of Columbia": "DC",
+	}
+
+	for in, want := range tests {
+		if got := NormalizeState(in); got != want {
+			t.Errorf("NormalizeState(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestStreetLine(t *testing.T) {
+	c := Components{Street: "123 Main St", Unit: "4B"}
+	if got := c.StreetLine(); got != "123 Main St #4B" {
+		t.Errorf("StreetLine() = %q", got)
+	}
+	c.Unit = ""
+	if got := c.StreetLine(); got != "123 Main St" {
+		t.Errorf("StreetLine() = %q", got)
+	}
+}
@@ -0,0 +1,118 @@
+package address
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+var ErrNotFound = errors.New("address not found")
+
+// Location is the result of geocoding an address
+type Location struct {
+	Latitude  float64
+	Longitude float64
+	City      string
+	State     string
+	Zip       string
+}
+
+// Geocoder resolves an address to coordinates
+type Geocoder interface {
+	Geocode(ctx context.Context, address string) (*Location, error)
+}
+
+// RealEstateAPIGeocoder geocodes through the realestateapi.com AutoComplete
+// endpoint, the same service we resolve re_api_id against
+type RealEstateAPIGeocoder struct {
+	APIKey string
+	URL    string
+	Client *http.Client
+}
+
+const realEstateAPIAutoCompleteURL = "https://api.realestateapi.com/v2/AutoComplete"
+
+func NewRealEstateAPIGeocoder(apiKey string) *RealEstateAPIGeocoder {
+	return &RealEstateAPIGeocoder{
+		APIKey: apiKey,
+		URL:    realEstateAPIAutoCompleteURL,
+		Client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (g *RealEstateAPIGeocoder) Geocode(ctx context.Context, address string) (*Location, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"search":       address,
+		"search_types": []string{"A"}, // Only full addresses
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", g.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", g.APIKey)
+
+	resp, err := g.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("geocoder returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Data []struct {
+			SearchType string  `json:"searchType"`
+			City       string  `json:"city"`
+			State      string  `json:"state"`
+			Zip        string  `json:"zip"`
+			Latitude   float64 `json:"latitude"`
+			Longitude  float64 `json:"longitude"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode geocoder response: %v", err)
+	}
+
+	for _, item := range result.Data {
+		if item.SearchType == "A" && (item.Latitude != 0 || item.Longitude != 0) {
+			return &Location{
+				Latitude:  item.Latitude,
+				Longitude: item.Longitude,
+				City:      item.City,
+				State:     NormalizeState(item.State),
+				Zip:       item.Zip,
+			}, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+var (
+	defaultGeocoder     Geocoder
+	defaultGeocoderOnce sync.Once
+)
+
+// DefaultGeocoder returns the geocoder configured through the environment
+// (REAL_ESTATE_API_KEY), or nil when geocoding is not configured
+func DefaultGeocoder() Geocoder {
+	defaultGeocoderOnce.Do(func() {
+		if apiKey := os.Getenv("REAL_ESTATE_API_KEY"); apiKey != "" {
+			defaultGeocoder = NewRealEstateAPIGeocoder(apiKey)
+		}
+	})
+	return defaultGeocoder
+}
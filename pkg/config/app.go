@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
@@ -39,6 +40,43 @@ func Connect() {
 	db = d
 }
 
+// GetDB returns the database connection, connecting on first use. Models
+// call it from their init functions, which run in file name order.
 func GetDB() *gorm.DB {
+	if db == nil {
+		Connect()
+	}
 	return db
 }
+
+// APIBaseURL is the public URL of this API, used in links that point back
+// at it (e.g. email verification). Set with API_BASE_URL.
+func APIBaseURL() string {
+	return envOrDefault("API_BASE_URL", "http://localhost:8080")
+}
+
+// AppBaseURL is the public URL of the website, used in links to pages such
+// as the password reset form. Set with APP_BASE_URL.
+func AppBaseURL() string {
+	return envOrDefault("APP_BASE_URL", APIBaseURL())
+}
+
+// LeadsEmail receives buyer inquiries on properties without a deal holder
+// email. Set with LEADS_EMAIL; when it is unset such inquiries are only
+// kept in the leads inbox.
+func LeadsEmail() string {
+	return os.Getenv("LEADS_EMAIL")
+}
+
+// RequireStaffTwoFactor reports whether admins and employees must use
+// two-factor authentication to act with their role. Set REQUIRE_STAFF_2FA=true.
+func RequireStaffTwoFactor() bool {
+	return os.Getenv("REQUIRE_STAFF_2FA") == "true"
+}
+
+func envOrDefault(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return strings.TrimRight(value, "/")
+	}
+	return fallback
+}
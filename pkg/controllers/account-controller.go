@@ -0,0 +1,259 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"api/pkg/config"
+	"api/pkg/mail"
+	"api/pkg/models"
+	"api/pkg/utils"
+)
+
+// How long emailed links stay valid
+const (
+	passwordResetTTL     = 1 * time.Hour
+	emailVerificationTTL = 48 * time.Hour
+)
+
+const minPasswordLength = 8
+
+// Throttle for emails sent on request, per client IP and per address: after
+// 5 each further one waits twice as long, from 1 minute up to 1 hour, so
+// nobody's inbox can be flooded with reset or verification links
+var accountEmailThrottle = utils.NewThrottle(5, 1*time.Minute, 1*time.Hour)
+
+const tooManyEmailsMessage = "Too many emails requested, please try again later"
+
+// Request structure for requesting a password reset email
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+// Request structure for setting a new password with a reset token
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// Send a password reset link. The response, and how long it takes, are the
+// same whether or not the email belongs to an account: the account is only
+// looked up when the email is sent in the background. So this cannot be used
+// to discover accounts.
+func ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req ForgotPasswordRequest
+	utils.ParseBody(r, &req)
+
+	if req.Email == "" {
+		http.Error(w, "Email is required", http.StatusBadRequest)
+		return
+	}
+
+	if !throttleAccountEmail(w, r, req.Email) {
+		return
+	}
+
+	sendPasswordResetEmail(req.Email)
+
+	utils.RespondJSON(w, http.StatusAccepted, map[string]string{
+		"message": "If an account exists for this email, a password reset link has been sent",
+	})
+}
+
+// Set a new password using the token from a password reset email
+func ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req ResetPasswordRequest
+	utils.ParseBody(r, &req)
+
+	if req.Token == "" || req.Password == "" {
+		http.Error(w, "Token and password are required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Password) < minPasswordLength {
+		http.Error(w, fmt.Sprintf("Password must be at least %d characters", minPasswordLength), http.StatusBadRequest)
+		return
+	}
+
+	user, claims, ok := redeemActionToken(w, req.Token, utils.PurposePasswordReset)
+	if !ok {
+		return
+	}
+
+	if err := user.UpdatePassword(req.Password); err != nil {
+		http.Error(w, "Failed to update password", http.StatusInternalServerError)
+		return
+	}
+
+	// Whoever knew the old password is signed out
+	if err := models.RevokeUserTokens(user.ID); err != nil {
+		fmt.Println("failed to revoke tokens after password reset:", err)
+	}
+
+	// Receiving the reset email proves ownership of the address too
+	if user.EmailVerifiedAt == nil && claims.Email == user.Email {
+		user.MarkEmailVerified()
+	}
+
+	utils.RespondJSON(w, http.StatusOK, map[string]string{
+		"message": "Password has been reset",
+	})
+}
+
+// Confirm an email address using the token from a verification email
+func VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		http.Error(w, "Token is required", http.StatusBadRequest)
+		return
+	}
+
+	user, _, ok := redeemActionToken(w, token, utils.PurposeEmailVerification)
+	if !ok {
+		return
+	}
+
+	if err := user.MarkEmailVerified(); err != nil {
+		http.Error(w, "Failed to verify email", http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"message":           "Email has been verified",
+		"email_verified_at": user.EmailVerifiedAt,
+	})
+}
+
+// Send a new verification email to the authenticated user
+func ResendVerificationEmail(w http.ResponseWriter, r *http.Request) {
+	user, ok := loadCurrentUser(w, r)
+	if !ok {
+		return
+	}
+
+	if user.EmailVerifiedAt != nil {
+		http.Error(w, "Email is already verified", http.StatusConflict)
+		return
+	}
+
+	if !throttleAccountEmail(w, r, user.Email) {
+		return
+	}
+
+	if err := sendVerificationEmail(user); err != nil {
+		http.Error(w, "Failed to send verification email, please try again later", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// throttleAccountEmail counts a requested email against the client IP and
+// the address. It writes 429 and returns false when either has to wait.
+func throttleAccountEmail(w http.ResponseWriter, r *http.Request, email string) bool {
+	keys := []string{"ip:" + utils.ClientIP(r), "email:" + strings.ToLower(strings.TrimSpace(email))}
+
+	var wait time.Duration
+	for _, key := range keys {
+		if keyWait := accountEmailThrottle.RetryAfter(key); keyWait > wait {
+			wait = keyWait
+		}
+	}
+	if wait > 0 {
+		writeTooManyAttempts(w, wait, tooManyEmailsMessage)
+		return false
+	}
+
+	for _, key := range keys {
+		accountEmailThrottle.Fail(key)
+	}
+	return true
+}
+
+// redeemActionToken validates an emailed token, checks it still matches the
+// account it was issued for and marks it used. It writes an error response
+// and returns false when the token cannot be redeemed.
+func redeemActionToken(w http.ResponseWriter, token string, purpose string) (*models.User, *utils.ActionClaims, bool) {
+	claims, err := utils.ValidateActionToken(token, purpose)
+	if err != nil {
+		http.Error(w, "Invalid or expired token", http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	user, err := models.GetUserById(claims.UserID)
+	if err != nil || user.IsDisabled() || user.Email != claims.Email {
+		// The account is gone or its email changed since the token was sent
+		http.Error(w, "Invalid or expired token", http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	// Once the password changes every earlier reset link is void
+	if purpose == utils.PurposePasswordReset && user.PasswordChangedSince(claims.IssuedAt.Time) {
+		http.Error(w, "This link has already been used", http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	if err := models.ConsumeActionToken(claims.ID, claims.ExpiresAt.Time); err != nil {
+		if errors.Is(err, models.ErrActionTokenUsed) {
+			http.Error(w, "This link has already been used", http.StatusBadRequest)
+		} else {
+			http.Error(w, "Failed to redeem token", http.StatusInternalServerError)
+		}
+		return nil, nil, false
+	}
+
+	return user, claims, true
+}
+
+// sendPasswordResetEmail queues a reset link for the account of email, if
+// there is an enabled one
+func sendPasswordResetEmail(email string) error {
+	return queueEmail(emailJob{
+		name: "password reset",
+		compose: func() (*mail.Message, error) {
+			user, err := models.GetUserByEmail(email)
+			if err != nil || user.IsDisabled() {
+				return nil, nil
+			}
+
+			token, err := utils.GenerateActionToken(user.ID, user.Email, utils.PurposePasswordReset, passwordResetTTL)
+			if err != nil {
+				return nil, err
+			}
+
+			link := config.AppBaseURL() + "/reset-password?token=" + url.QueryEscape(token)
+
+			return &mail.Message{
+				To:      []string{user.Email},
+				Subject: "Reset your password",
+				Body: "We received a request to reset the password for your account.\n\n" +
+					"Choose a new password here (the link expires in 1 hour and works once):\n" + link + "\n\n" +
+					"If you did not ask for this, you can ignore this email.\n",
+			}, nil
+		},
+	})
+}
+
+// sendVerificationEmail queues a link confirming the user's email address
+func sendVerificationEmail(user *models.User) error {
+	return queueEmail(emailJob{
+		name: "verification",
+		compose: func() (*mail.Message, error) {
+			token, err := utils.GenerateActionToken(user.ID, user.Email, utils.PurposeEmailVerification, emailVerificationTTL)
+			if err != nil {
+				return nil, err
+			}
+
+			link := config.APIBaseURL() + "/auth/verify-email?token=" + url.QueryEscape(token)
+
+			return &mail.Message{
+				To:      []string{user.Email},
+				Subject: "Confirm your email address",
+				Body:    "Please confirm your email address by opening this link (it expires in 48 hours):\n" + link + "\n",
+			}, nil
+		},
+	})
+}
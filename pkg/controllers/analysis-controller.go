@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"api/pkg/finance"
+	"api/pkg/models"
+	"api/pkg/utils"
+)
+
+// GetPropertyAnalysis underwrites a property from its stored numbers. Query
+// parameters override them for what-if scenarios:
+//
+//	price, down_payment (dollars) or down_payment_percent, rate (annual %),
+//	term (years), rent (monthly), vacancy (%), management (%), closing_costs
+func GetPropertyAnalysis(w http.ResponseWriter, r *http.Request) {
+	property, ok := loadProperty(w, r)
+	if !ok {
+		return
+	}
+
+	inputs, warnings, err := analysisInputs(property, r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	analysis := finance.Analyze(inputs)
+	analysis.Warnings = append(warnings, analysis.Warnings...)
+
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"property_id": property.ID,
+		"analysis":    analysis,
+	})
+}
+
+// analysisInputs combines the property's numbers with the query overrides
+func analysisInputs(property *models.Property, query url.Values) (finance.Inputs, []string, error) {
+	warnings := []string{}
+
+	inputs := finance.Inputs{
+		PurchasePrice:      property.PurchasePrice,
+		DownPayment:        property.BalanceToClose,
+		InterestRate:       property.InterestRate,
+		TermYears:          finance.DefaultTermYears,
+		MonthlyRent:        property.RentZestimate,
+		MonthlyEscrow:      property.Escrow,
+		MonthlyHoldingCost: property.MonthlyHoldingCost,
+		AssignmentFee:      property.AssignmentFee,
+		VacancyPercent:     finance.DefaultVacancyPercent,
+		ManagementPercent:  finance.DefaultManagementPercent,
+	}
+	if inputs.PurchasePrice == nil {
+		inputs.PurchasePrice = property.Price
+	}
+	if property.MonthlyHoaFee != nil {
+		hoa := float64(*property.MonthlyHoaFee)
+		inputs.MonthlyHOA = &hoa
+	}
+
+	// Stored rates outside 0-100% are data entry errors, not rates
+	if inputs.InterestRate != nil && (*inputs.InterestRate < 0 || *inputs.InterestRate > 100) {
+		warnings = append(warnings, fmt.Sprintf("stored interest rate %g%% is out of range and was ignored", *inputs.InterestRate))
+		inputs.InterestRate = nil
+	}
+
+	overrides := []struct {
+		param  string
+		target **float64
+		max    float64
+	}{
+		{"price", &inputs.PurchasePrice, 0},
+		{"down_payment", &inputs.DownPayment, 0},
+		{"rate", &inputs.InterestRate, 100},
+		{"rent", &inputs.MonthlyRent, 0},
+		{"closing_costs", &inputs.ClosingCosts, 0},
+	}
+	for _, override := range overrides {
+		value, ok, err := analysisParam(query, override.param, override.max)
+		if err != nil {
+			return inputs, nil, err
+		}
+		if ok {
+			*override.target = &value
+		}
+	}
+
+	if percent, ok, err := analysisParam(query, "down_payment_percent", 100); err != nil {
+		return inputs, nil, err
+	} else if ok {
+		if query.Get("down_payment") != "" {
+			return inputs, nil, fmt.Errorf("use either down_payment or down_payment_percent")
+		}
+		if inputs.PurchasePrice == nil {
+			return inputs, nil, fmt.Errorf("down_payment_percent needs a purchase price")
+		}
+		down := *inputs.PurchasePrice * percent / 100
+		inputs.DownPayment = &down
+	}
+
+	if term, ok, err := analysisParam(query, "term", 50); err != nil {
+		return inputs, nil, err
+	} else if ok {
+		if term < 1 || term != float64(int(term)) {
+			return inputs, nil, fmt.Errorf("term must be a whole number of years between 1 and 50")
+		}
+		inputs.TermYears = int(term)
+	}
+
+	for param, target := range map[string]*float64{"vacancy": &inputs.VacancyPercent, "management": &inputs.ManagementPercent} {
+		value, ok, err := analysisParam(query, param, 100)
+		if err != nil {
+			return inputs, nil, err
+		}
+		if ok {
+			*target = value
+		}
+	}
+
+	return inputs, warnings, nil
+}
+
+// analysisParam parses a non-negative number, capped at max when max > 0
+func analysisParam(query url.Values, param string, max float64) (float64, bool, error) {
+	raw := query.Get(param)
+	if raw == "" {
+		return 0, false, nil
+	}
+
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil || value < 0 || (max > 0 && value > max) {
+		if max > 0 {
+			return 0, false, fmt.Errorf("%s must be a number between 0 and %g", param, max)
+		}
+		return 0, false, fmt.Errorf("%s must be a non-negative number", param)
+	}
+	return value, true, nil
+}
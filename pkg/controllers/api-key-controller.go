@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"api/pkg/middleware"
+	"api/pkg/models"
+	"api/pkg/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// Request structure for creating an API key. ExpiresAt is optional; keys
+// without it work until revoked.
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// List API keys with their usage (admin only)
+func GetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	page, pageSize, err := parsePagination(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	keys, total := models.GetPaginatedAPIKeys(pageSize, (page-1)*pageSize)
+
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"api_keys": keys,
+		"total":    total,
+		"page":     page,
+		"pageSize": pageSize,
+	})
+}
+
+// Create an API key (admin only). The plain key is in the response once
+// and cannot be retrieved later.
+func CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req CreateAPIKeyRequest
+	utils.ParseBody(r, &req)
+
+	if req.Name == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Scopes) == 0 {
+		http.Error(w, "At least one scope is required", http.StatusBadRequest)
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !middleware.IsAPIKeyScope(scope) {
+			http.Error(w, "Unknown scope: "+scope, http.StatusBadRequest)
+			return
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		http.Error(w, "expires_at must be in the future", http.StatusBadRequest)
+		return
+	}
+
+	var createdBy *uint
+	if user, ok := middleware.GetUserFromContext(r.Context()); ok && !user.IsAPIKey() {
+		createdBy = &user.ID
+	}
+
+	key, plain, err := models.CreateAPIKey(req.Name, req.Scopes, req.ExpiresAt, createdBy)
+	if err != nil {
+		http.Error(w, "Failed to create API key", http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusCreated, map[string]interface{}{
+		"api_key": key,
+		"key":     plain,
+	})
+}
+
+// Revoke an API key (admin only)
+func RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	ID, err := strconv.ParseUint(mux.Vars(r)["KeyId"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid API key ID", http.StatusBadRequest)
+		return
+	}
+
+	key, err := models.GetAPIKeyById(uint(ID))
+	if err != nil {
+		http.Error(w, "API key not found", http.StatusNotFound)
+		return
+	}
+
+	if err := key.Revoke(); err != nil {
+		http.Error(w, "Failed to revoke API key", http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, key)
+}
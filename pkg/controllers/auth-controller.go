@@ -3,17 +3,22 @@ package controllers
 import (
 	"api/pkg/models"
 	"api/pkg/utils"
-	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"gorm.io/gorm"
 )
 
-// Request structure for registration
+// Request structure for registration. Public sign-up always creates a
+// regular user; staff accounts are created through /api/admin/users.
 type RegisterRequest struct {
-	Email      string `json:"email"`
-	Password   string `json:"password"`
-	IsEmployee bool   `json:"is_employee"` // Add this line
+	Email    string `json:"email"`
+	Password string `json:"password"`
 }
 
 // Request structure for login
@@ -22,11 +27,48 @@ type LoginRequest struct {
 	Password string `json:"password"`
 }
 
-// Response structure for auth
+// Request structure for refresh and logout
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Response structure for auth. Token is a short-lived access token;
+// RefreshToken renews it through /auth/refresh.
 type AuthResponse struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"` // seconds until Token expires
+
+	// Set for staff who must enable 2FA before using their role
+	TwoFactorSetupRequired bool `json:"two_factor_setup_required,omitempty"`
+}
+
+// Response structure for the first step of a login with 2FA. The challenge
+// token and a code from the authenticator app go to /auth/login/2fa.
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	ChallengeToken    string `json:"challenge_token"`
+	ExpiresIn         int    `json:"expires_in"` // seconds until ChallengeToken expires
 }
 
+// Request structure for the second step of a login with 2FA. Code is a
+// TOTP code or a recovery code.
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+}
+
+// How long the second step of a login may take
+const twoFactorChallengeTTL = 5 * time.Minute
+
+// Per-IP login throttle: after 20 failures from one address each further
+// attempt waits twice as long, from 1 second up to 15 minutes
+var loginThrottle = utils.NewThrottle(20, 1*time.Second, 15*time.Minute)
+
+// The same answer for every throttled login, so that it does not tell
+// whether the email has an account or the account is locked
+const tooManyLoginsMessage = "Too many failed login attempts, please try again later"
+
 // Register a new user
 func Register(w http.ResponseWriter, r *http.Request) {
 	var req RegisterRequest
@@ -40,8 +82,7 @@ func Register(w http.ResponseWriter, r *http.Request) {
 
 	// Create new user
 	user := &models.User{
-		Email:      req.Email,
-		IsEmployee: req.IsEmployee, // Add this line
+		Email: req.Email,
 	}
 
 	// Hash the password
@@ -61,17 +102,11 @@ func Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Generate JWT token
-	token, err := utils.GenerateToken(createdUser.ID, createdUser.Email, createdUser.IsAdmin, createdUser.IsEmployee)
-	if err != nil {
-		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
-		return
-	}
+	// Ask the user to confirm their email address
+	sendVerificationEmail(createdUser)
 
-	// Return the token
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(AuthResponse{Token: token})
+	// Generate tokens and return them
+	writeAuthResponse(w, createdUser, http.StatusCreated, false)
 }
 
 // Login user
@@ -85,28 +120,223 @@ func Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Slow down clients that keep guessing, whatever account they target
+	clientIP := utils.ClientIP(r)
+	if wait := loginThrottle.RetryAfter(clientIP); wait > 0 {
+		writeTooManyAttempts(w, wait, tooManyLoginsMessage)
+		return
+	}
+
 	// Get user from database
+	// Unknown emails are throttled like accounts, so that the answers are
+	// the same whether or not the email has an account
 	user, err := models.GetUserByEmail(req.Email)
 	if err != nil {
+		if wait := models.UnknownLoginRetryAfter(req.Email); wait > 0 {
+			writeTooManyAttempts(w, wait, tooManyLoginsMessage)
+			return
+		}
+		loginThrottle.Fail(clientIP)
+		models.RecordUnknownLogin(req.Email)
 		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
 		return
 	}
 
+	// Locked or backing-off accounts are refused before the password is
+	// checked, so a correct guess during the wait gives nothing away
+	if wait := user.LoginRetryAfter(); wait > 0 {
+		writeTooManyAttempts(w, wait, tooManyLoginsMessage)
+		return
+	}
+
 	// Check password
 	if !user.CheckPassword(req.Password) {
+		loginThrottle.Fail(clientIP)
+		if err := user.RecordFailedLogin(); err != nil {
+			fmt.Println("failed to record failed login:", err)
+		}
 		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
 		return
 	}
 
-	// Generate JWT token
-	token, err := utils.GenerateToken(user.ID, user.Email, user.IsAdmin, user.IsEmployee)
+	// Disabled accounts cannot log in
+	if user.IsDisabled() {
+		http.Error(w, "Account is disabled", http.StatusForbidden)
+		return
+	}
+
+	// With 2FA the password only earns a challenge; failure counts are kept
+	// until the second step succeeds so codes cannot be guessed endlessly
+	if user.TwoFactorEnabled() {
+		challenge, err := utils.GenerateActionToken(user.ID, user.Email, utils.PurposeTwoFactorLogin, twoFactorChallengeTTL)
+		if err != nil {
+			http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+			return
+		}
+
+		utils.RespondJSON(w, http.StatusOK, TwoFactorChallengeResponse{
+			TwoFactorRequired: true,
+			ChallengeToken:    challenge,
+			ExpiresIn:         int(twoFactorChallengeTTL.Seconds()),
+		})
+		return
+	}
+
+	loginThrottle.Reset(clientIP)
+	if err := user.ResetFailedLogins(); err != nil {
+		fmt.Println("failed to reset failed logins:", err)
+	}
+
+	// Generate tokens and return them
+	writeAuthResponse(w, user, http.StatusOK, false)
+}
+
+// Complete a login with 2FA using the challenge token from /auth/login
+func LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req TwoFactorLoginRequest
+	utils.ParseBody(r, &req)
+
+	if req.ChallengeToken == "" || req.Code == "" {
+		http.Error(w, "Challenge token and code are required", http.StatusBadRequest)
+		return
+	}
+
+	clientIP := utils.ClientIP(r)
+	if wait := loginThrottle.RetryAfter(clientIP); wait > 0 {
+		writeTooManyAttempts(w, wait, tooManyLoginsMessage)
+		return
+	}
+
+	claims, err := utils.ValidateActionToken(req.ChallengeToken, utils.PurposeTwoFactorLogin)
+	if err != nil {
+		http.Error(w, "Invalid or expired challenge, please log in again", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := models.GetUserById(claims.UserID)
+	if err != nil || user.Email != claims.Email || !user.TwoFactorEnabled() {
+		http.Error(w, "Invalid or expired challenge, please log in again", http.StatusUnauthorized)
+		return
+	}
+
+	if user.IsDisabled() {
+		http.Error(w, "Account is disabled", http.StatusForbidden)
+		return
+	}
+
+	if wait := user.LoginRetryAfter(); wait > 0 {
+		writeTooManyAttempts(w, wait, tooManyLoginsMessage)
+		return
+	}
+
+	if !user.VerifyTwoFactor(req.Code) {
+		loginThrottle.Fail(clientIP)
+		if err := user.RecordFailedLogin(); err != nil {
+			fmt.Println("failed to record failed login:", err)
+		}
+		http.Error(w, "Invalid two-factor code", http.StatusUnauthorized)
+		return
+	}
+
+	// Each challenge completes one login
+	if err := models.ConsumeActionToken(claims.ID, claims.ExpiresAt.Time); err != nil {
+		if errors.Is(err, models.ErrActionTokenUsed) {
+			http.Error(w, "Invalid or expired challenge, please log in again", http.StatusUnauthorized)
+		} else {
+			http.Error(w, "Failed to complete login", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	loginThrottle.Reset(clientIP)
+	if err := user.ResetFailedLogins(); err != nil {
+		fmt.Println("failed to reset failed logins:", err)
+	}
+
+	writeAuthResponse(w, user, http.StatusOK, true)
+}
+
+// Exchange a refresh token for a new access token and refresh token
+func Refresh(w http.ResponseWriter, r *http.Request) {
+	var req RefreshRequest
+	utils.ParseBody(r, &req)
+
+	if req.RefreshToken == "" {
+		http.Error(w, "Refresh token is required", http.StatusBadRequest)
+		return
+	}
+
+	user, refreshToken, twoFactor, err := models.RotateRefreshToken(req.RefreshToken)
+	if err != nil {
+		http.Error(w, "Invalid or expired refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	token, err := utils.GenerateToken(user.ID, user.Email, user.IsAdmin, user.IsEmployee, twoFactor)
 	if err != nil {
 		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
 		return
 	}
 
-	// Return the token
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(AuthResponse{Token: token})
+	utils.RespondJSON(w, http.StatusOK, AuthResponse{
+		Token:                  token,
+		RefreshToken:           refreshToken,
+		ExpiresIn:              int(utils.AccessTokenTTL.Seconds()),
+		TwoFactorSetupRequired: user.TwoFactorRequired() && !twoFactor,
+	})
+}
+
+// Log out: end the session of the refresh token and revoke the access token
+// sent in the Authorization header, if any. Expired access tokens are fine
+// here, so this route is not behind AuthMiddleware.
+func Logout(w http.ResponseWriter, r *http.Request) {
+	var req RefreshRequest
+	utils.ParseBody(r, &req)
+
+	if req.RefreshToken != "" {
+		models.RevokeRefreshToken(req.RefreshToken)
+	}
+
+	if authHeader := r.Header.Get("Authorization"); strings.HasPrefix(authHeader, "Bearer ") {
+		if claims, err := utils.ValidateToken(strings.TrimPrefix(authHeader, "Bearer ")); err == nil && claims.ExpiresAt != nil {
+			models.RevokeAccessToken(claims.ID, claims.ExpiresAt.Time)
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Publish the public keys access tokens can be verified with
+func GetJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	utils.RespondJSON(w, http.StatusOK, utils.PublicJWKS())
+}
+
+// writeAuthResponse starts a new session for the user and writes the access
+// and refresh tokens. twoFactor tells whether the user proved a second factor.
+func writeAuthResponse(w http.ResponseWriter, user *models.User, status int, twoFactor bool) {
+	token, err := utils.GenerateToken(user.ID, user.Email, user.IsAdmin, user.IsEmployee, twoFactor)
+	if err != nil {
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	refreshToken, err := models.CreateRefreshToken(user.ID, twoFactor)
+	if err != nil {
+		http.Error(w, "Failed to generate refresh token", http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondJSON(w, status, AuthResponse{
+		Token:                  token,
+		RefreshToken:           refreshToken,
+		ExpiresIn:              int(utils.AccessTokenTTL.Seconds()),
+		TwoFactorSetupRequired: user.TwoFactorRequired() && !twoFactor,
+	})
+}
+
+// writeTooManyAttempts answers 429 with a Retry-After header in whole seconds
+func writeTooManyAttempts(w http.ResponseWriter, wait time.Duration, message string) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	http.Error(w, message, http.StatusTooManyRequests)
 }
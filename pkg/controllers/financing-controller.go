@@ -0,0 +1,253 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"api/pkg/finance"
+	"api/pkg/middleware"
+	"api/pkg/models"
+	"api/pkg/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// Request structure for creating or replacing a financing term
+type FinancingTermRequest struct {
+	Type         string        `json:"type"`
+	Position     *int          `json:"position"`
+	LoanBalance  float64       `json:"loan_balance"`
+	InterestRate float64       `json:"interest_rate"`
+	TermMonths   *int          `json:"term_months"`
+	Payment      *float64      `json:"monthly_payment"`
+	FirstPayment *finance.Date `json:"first_payment_date"`
+	BalloonDate  *finance.Date `json:"balloon_date"`
+	Notes        *string       `json:"notes"`
+}
+
+// List the financing terms of a property
+func GetFinancingTerms(w http.ResponseWriter, r *http.Request) {
+	property, ok := loadProperty(w, r)
+	if !ok {
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"financing": models.GetFinancingTerms(property.ID),
+	})
+}
+
+// Add a financing term to a property
+func CreateFinancingTerm(w http.ResponseWriter, r *http.Request) {
+	property, ok := loadProperty(w, r)
+	if !ok {
+		return
+	}
+	if !authorizePropertyChange(w, r, property, middleware.PermissionUpdateProperty) {
+		return
+	}
+
+	term := &models.FinancingTerm{PropertyID: property.ID}
+	if !applyFinancingTermRequest(w, r, term) {
+		return
+	}
+
+	if err := term.Save(); err != nil {
+		http.Error(w, "Failed to save financing term", http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusCreated, term)
+}
+
+// Replace a financing term
+func UpdateFinancingTerm(w http.ResponseWriter, r *http.Request) {
+	property, term, ok := loadFinancingTerm(w, r)
+	if !ok {
+		return
+	}
+	if !authorizePropertyChange(w, r, property, middleware.PermissionUpdateProperty) {
+		return
+	}
+
+	if !applyFinancingTermRequest(w, r, term) {
+		return
+	}
+
+	if err := term.Save(); err != nil {
+		http.Error(w, "Failed to save financing term", http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, term)
+}
+
+// Remove a financing term
+func DeleteFinancingTerm(w http.ResponseWriter, r *http.Request) {
+	property, term, ok := loadFinancingTerm(w, r)
+	if !ok {
+		return
+	}
+	if !authorizePropertyChange(w, r, property, middleware.PermissionUpdateProperty) {
+		return
+	}
+
+	if err := term.Delete(); err != nil {
+		http.Error(w, "Failed to delete financing term", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Month-by-month amortization schedule of a financing term, as JSON or, with
+// format=csv or an Accept: text/csv header, as CSV
+func GetAmortizationSchedule(w http.ResponseWriter, r *http.Request) {
+	_, term, ok := loadFinancingTerm(w, r)
+	if !ok {
+		return
+	}
+
+	schedule, err := finance.Amortize(term.Loan())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" && strings.Contains(r.Header.Get("Accept"), "text/csv") {
+		format = "csv"
+	}
+
+	switch format {
+	case "", "json":
+		utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+			"financing": term,
+			"schedule":  schedule,
+		})
+	case "csv":
+		writeScheduleCSV(w, term, schedule)
+	default:
+		http.Error(w, "format must be json or csv", http.StatusBadRequest)
+	}
+}
+
+func writeScheduleCSV(w http.ResponseWriter, term *models.FinancingTerm, schedule *finance.Schedule) {
+	var buf bytes.Buffer
+	out := csv.NewWriter(&buf)
+	out.Write([]string{"number", "date", "payment", "principal", "interest", "balloon", "balance"})
+	for _, row := range schedule.Rows {
+		out.Write([]string{
+			strconv.Itoa(row.Number),
+			row.Date.String(),
+			money(row.Payment),
+			money(row.Principal),
+			money(row.Interest),
+			money(row.Balloon),
+			money(row.Balance),
+		})
+	}
+	out.Flush()
+	if err := out.Error(); err != nil {
+		http.Error(w, "Failed to write CSV", http.StatusInternalServerError)
+		return
+	}
+
+	filename := fmt.Sprintf("property-%d-financing-%d-amortization.csv", term.PropertyID, term.ID)
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+func money(value float64) string {
+	return strconv.FormatFloat(value, 'f', 2, 64)
+}
+
+// applyFinancingTermRequest decodes the request body into term and
+// validates it. It writes 400 and returns false when that fails.
+func applyFinancingTermRequest(w http.ResponseWriter, r *http.Request, term *models.FinancingTerm) bool {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return false
+	}
+
+	var req FinancingTermRequest
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		http.Error(w, "Invalid financing term: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+
+	term.Type = req.Type
+	term.Position = 1
+	if req.Position != nil {
+		term.Position = *req.Position
+	}
+	term.LoanBalance = req.LoanBalance
+	term.InterestRate = req.InterestRate
+	term.TermMonths = req.TermMonths
+	term.Payment = req.Payment
+	term.FirstPayment = req.FirstPayment
+	term.BalloonDate = req.BalloonDate
+	term.Notes = req.Notes
+
+	if err := term.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+
+	// Catch terms that never pay off before they are stored
+	if _, err := finance.Amortize(term.Loan()); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// loadProperty loads the property named by the PropertyId route variable.
+// It writes an error response and returns false when that fails.
+func loadProperty(w http.ResponseWriter, r *http.Request) (*models.Property, bool) {
+	ID, err := strconv.ParseInt(mux.Vars(r)["PropertyId"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid property ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	property, _ := models.GetPropertyById(ID)
+	if property.ID == 0 {
+		http.Error(w, "Property not found", http.StatusNotFound)
+		return nil, false
+	}
+	return property, true
+}
+
+// loadFinancingTerm loads the property and the financing term named by the
+// route. It writes an error response and returns false when that fails.
+func loadFinancingTerm(w http.ResponseWriter, r *http.Request) (*models.Property, *models.FinancingTerm, bool) {
+	property, ok := loadProperty(w, r)
+	if !ok {
+		return nil, nil, false
+	}
+
+	ID, err := strconv.ParseUint(mux.Vars(r)["TermId"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid financing term ID", http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	term, err := models.GetFinancingTerm(property.ID, uint(ID))
+	if err != nil {
+		http.Error(w, "Financing term not found", http.StatusNotFound)
+		return nil, nil, false
+	}
+	return property, term, true
+}
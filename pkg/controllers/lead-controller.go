@@ -0,0 +1,312 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	netmail "net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"api/pkg/config"
+	"api/pkg/mail"
+	"api/pkg/middleware"
+	"api/pkg/models"
+	"api/pkg/utils"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	maxInquiryBodyBytes  = 64 << 10
+	maxInquiryMessageLen = 5000
+	maxLeadNoteLen       = 5000
+
+	// A buyer who sends the same property another inquiry within this
+	// window gets the usual answer, but nothing is stored or emailed
+	duplicateInquiryWindow = 10 * time.Minute
+)
+
+// Per-IP inquiry throttle: every inquiry counts, and after 5 from one
+// address each further one waits twice as long, from 1 minute up to 1 hour
+var inquiryThrottle = utils.NewThrottle(5, 1*time.Minute, 1*time.Hour)
+
+// Request structure for a buyer's inquiry about a property. Website is a
+// honeypot: the form hides it from people, so only bots fill it in.
+type InquiryRequest struct {
+	Name        string   `json:"name"`
+	Email       string   `json:"email"`
+	Phone       *string  `json:"phone"`
+	Message     *string  `json:"message"`
+	OfferAmount *float64 `json:"offer_amount"`
+	Website     string   `json:"website"`
+}
+
+// Request structure for moving a lead to another status
+type UpdateLeadRequest struct {
+	Status string `json:"status"`
+}
+
+// Request structure for adding a note to a lead
+type LeadNoteRequest struct {
+	Body string `json:"body"`
+}
+
+// Send interest in a property. The inquiry is stored as a lead and emailed
+// to the deal holder after the response. Spam gets the same answer as a
+// real inquiry.
+func CreateInquiry(w http.ResponseWriter, r *http.Request) {
+	clientIP := utils.ClientIP(r)
+	if wait := inquiryThrottle.RetryAfter(clientIP); wait > 0 {
+		writeTooManyAttempts(w, wait, "Too many inquiries, please try again later")
+		return
+	}
+
+	property, ok := loadProperty(w, r)
+	if !ok {
+		return
+	}
+
+	var req InquiryRequest
+	r.Body = http.MaxBytesReader(w, r.Body, maxInquiryBodyBytes)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	accepted := map[string]string{
+		"message": "Thanks for your interest, the deal holder will be in touch",
+	}
+	inquiryThrottle.Fail(clientIP)
+	if req.Website != "" {
+		utils.RespondJSON(w, http.StatusAccepted, accepted)
+		return
+	}
+
+	lead, err := newLead(property.ID, req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if models.HasRecentLead(property.ID, lead.Email, time.Now().Add(-duplicateInquiryWindow)) {
+		utils.RespondJSON(w, http.StatusAccepted, accepted)
+		return
+	}
+
+	lead.IPAddress = clientIP
+	if user, ok := middleware.GetUserFromContext(r.Context()); ok && !user.IsAPIKey() {
+		lead.UserID = &user.ID
+	}
+	if err := lead.Create(); err != nil {
+		http.Error(w, "Failed to save inquiry", http.StatusInternalServerError)
+		return
+	}
+
+	routeLead(property, lead)
+
+	utils.RespondJSON(w, http.StatusAccepted, accepted)
+}
+
+// newLead checks an inquiry and returns the lead to store
+func newLead(propertyID uint, req InquiryRequest) (*models.Lead, error) {
+	lead := &models.Lead{
+		PropertyID:  propertyID,
+		Name:        strings.TrimSpace(req.Name),
+		Email:       strings.TrimSpace(req.Email),
+		OfferAmount: req.OfferAmount,
+	}
+
+	if lead.Name == "" || len(lead.Name) > 255 {
+		return nil, errors.New("Name is required and must be at most 255 characters")
+	}
+	if address, err := netmail.ParseAddress(lead.Email); err != nil || address.Address != lead.Email || len(lead.Email) > 255 {
+		return nil, errors.New("A valid email address is required")
+	}
+	if req.Phone != nil {
+		if phone := strings.TrimSpace(*req.Phone); phone != "" {
+			if len(phone) > 32 {
+				return nil, errors.New("Phone must be at most 32 characters")
+			}
+			lead.Phone = &phone
+		}
+	}
+	if req.Message != nil {
+		if message := strings.TrimSpace(*req.Message); message != "" {
+			if len(message) > maxInquiryMessageLen {
+				return nil, fmt.Errorf("Message must be at most %d characters", maxInquiryMessageLen)
+			}
+			lead.Message = &message
+		}
+	}
+	if lead.OfferAmount != nil && (*lead.OfferAmount <= 0 || *lead.OfferAmount >= 1e10) {
+		return nil, errors.New("offer_amount must be a positive amount")
+	}
+	return lead, nil
+}
+
+// routeLead queues the inquiry email to the property's deal holder, or to
+// LEADS_EMAIL when the property has none. Failures are only logged: the
+// lead is in the inbox either way.
+func routeLead(property *models.Property, lead *models.Lead) {
+	to := config.LeadsEmail()
+	if property.DealHolderEmail != nil && *property.DealHolderEmail != "" {
+		to = *property.DealHolderEmail
+	}
+	if to == "" {
+		return
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "%s is interested in %s.\n\n", lead.Name, property.Address)
+	fmt.Fprintf(&body, "Email: %s\n", lead.Email)
+	if lead.Phone != nil {
+		fmt.Fprintf(&body, "Phone: %s\n", *lead.Phone)
+	}
+	if lead.OfferAmount != nil {
+		fmt.Fprintf(&body, "Offer: $%.2f\n", *lead.OfferAmount)
+	}
+	if lead.Message != nil {
+		fmt.Fprintf(&body, "\n%s\n", *lead.Message)
+	}
+	fmt.Fprintf(&body, "\nReply to this email to answer the buyer. The inquiry is lead #%d in the leads inbox.\n", lead.ID)
+
+	message := &mail.Message{
+		To:      []string{to},
+		ReplyTo: lead.Email,
+		Subject: "New inquiry: " + property.Address,
+		Body:    body.String(),
+	}
+	queueEmail(emailJob{
+		name:    fmt.Sprintf("inquiry (lead %d)", lead.ID),
+		compose: func() (*mail.Message, error) { return message, nil },
+		sent: func(msg *mail.Message) {
+			if err := lead.SetRoutedTo(msg.To[0]); err != nil {
+				fmt.Println("failed to record inquiry routing:", err)
+			}
+		},
+	})
+}
+
+// List leads, newest first, optionally narrowed by status, property_id and
+// a search in the buyer's name and email
+func GetLeads(w http.ResponseWriter, r *http.Request) {
+	page, pageSize, err := parsePagination(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := models.LeadFilter{
+		Status: query.Get("status"),
+		Search: query.Get("search"),
+	}
+	if filter.Status != "" && !models.ValidLeadStatus(filter.Status) {
+		http.Error(w, "Invalid status parameter", http.StatusBadRequest)
+		return
+	}
+	if propertyID := query.Get("property_id"); propertyID != "" {
+		ID, err := strconv.ParseUint(propertyID, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid property_id parameter", http.StatusBadRequest)
+			return
+		}
+		value := uint(ID)
+		filter.PropertyID = &value
+	}
+
+	leads, total := models.GetPaginatedLeads(pageSize, (page-1)*pageSize, filter)
+
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"leads":    leads,
+		"total":    total,
+		"page":     page,
+		"pageSize": pageSize,
+	})
+}
+
+// Show a lead with its notes
+func GetLead(w http.ResponseWriter, r *http.Request) {
+	lead, ok := loadLead(w, r)
+	if !ok {
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, lead)
+}
+
+// Move a lead to another status
+func UpdateLead(w http.ResponseWriter, r *http.Request) {
+	lead, ok := loadLead(w, r)
+	if !ok {
+		return
+	}
+
+	var req UpdateLeadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !models.ValidLeadStatus(req.Status) {
+		http.Error(w, "status must be new, contacted, qualified or closed", http.StatusBadRequest)
+		return
+	}
+
+	if err := lead.SetStatus(req.Status); err != nil {
+		http.Error(w, "Failed to update lead", http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, lead)
+}
+
+// Add a note to a lead
+func AddLeadNote(w http.ResponseWriter, r *http.Request) {
+	lead, ok := loadLead(w, r)
+	if !ok {
+		return
+	}
+
+	var req LeadNoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Body = strings.TrimSpace(req.Body)
+	if req.Body == "" || len(req.Body) > maxLeadNoteLen {
+		http.Error(w, fmt.Sprintf("body is required and must be at most %d characters", maxLeadNoteLen), http.StatusBadRequest)
+		return
+	}
+
+	var authorID *uint
+	if user, ok := middleware.GetUserFromContext(r.Context()); ok && !user.IsAPIKey() {
+		authorID = &user.ID
+	}
+
+	note, err := lead.AddNote(authorID, req.Body)
+	if err != nil {
+		http.Error(w, "Failed to add note", http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusCreated, note)
+}
+
+// loadLead loads the lead named by the route. It writes an error response
+// and returns false when that fails.
+func loadLead(w http.ResponseWriter, r *http.Request) (*models.Lead, bool) {
+	ID, err := strconv.ParseUint(mux.Vars(r)["LeadId"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid lead ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	lead, err := models.GetLeadById(uint(ID))
+	if err != nil {
+		http.Error(w, "Lead not found", http.StatusNotFound)
+		return nil, false
+	}
+	return lead, true
+}
@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"api/pkg/mail"
+)
+
+// Emails are sent by a few background workers from a bounded queue, so a
+// slow mail server neither holds up requests nor piles up goroutines, and
+// the response does not depend on whether an email was sent. Each email is
+// tried a few times, waiting twice as long after every failure.
+const (
+	emailWorkers     = 2
+	emailQueueSize   = 100
+	emailAttempts    = 3
+	emailRetryDelay  = 15 * time.Second
+	emailSendTimeout = 30 * time.Second
+)
+
+var errEmailQueueFull = errors.New("too many emails waiting to be sent")
+
+// emailJob is an email waiting in the queue. compose runs on the worker and
+// returns nil when there turns out to be nothing to send; sent, if set, is
+// called once the email went out.
+type emailJob struct {
+	name    string // for the log, e.g. "password reset"
+	compose func() (*mail.Message, error)
+	sent    func(msg *mail.Message)
+}
+
+var (
+	emailQueue     chan emailJob
+	emailQueueOnce sync.Once
+)
+
+// queueEmail hands job to the workers, or fails with errEmailQueueFull
+func queueEmail(job emailJob) error {
+	emailQueueOnce.Do(func() {
+		emailQueue = make(chan emailJob, emailQueueSize)
+		for i := 0; i < emailWorkers; i++ {
+			go sendEmails()
+		}
+	})
+
+	select {
+	case emailQueue <- job:
+		return nil
+	default:
+		fmt.Printf("email queue is full, %s email was not sent\n", job.name)
+		return errEmailQueueFull
+	}
+}
+
+// sendEmails is a worker of the email queue
+func sendEmails() {
+	for job := range emailQueue {
+		msg, err := job.compose()
+		if err != nil {
+			fmt.Printf("failed to prepare %s email: %v\n", job.name, err)
+			continue
+		}
+		if msg == nil {
+			continue
+		}
+
+		delay := emailRetryDelay
+		for attempt := 1; ; attempt++ {
+			ctx, cancel := context.WithTimeout(context.Background(), emailSendTimeout)
+			err := mail.DefaultSender().Send(ctx, *msg)
+			cancel()
+			if err == nil {
+				if job.sent != nil {
+					job.sent(msg)
+				}
+				break
+			}
+
+			fmt.Printf("failed to send %s email (attempt %d): %v\n", job.name, attempt, err)
+			if attempt == emailAttempts {
+				break
+			}
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+}
@@ -0,0 +1,337 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"api/pkg/finance"
+	"api/pkg/middleware"
+	"api/pkg/models"
+	"api/pkg/utils"
+
+	"github.com/gorilla/mux"
+)
+
+const maxOfferTermsLen = 5000
+
+// Request structure for submitting or countering an offer. A counter-offer
+// keeps the terms of the offer it answers unless they are given again.
+type OfferRequest struct {
+	Price         *float64      `json:"price"`
+	DownPayment   *float64      `json:"down_payment"`
+	EarnestMoney  *float64      `json:"earnest_money"`
+	FinancingType *string       `json:"financing_type"`
+	InterestRate  *float64      `json:"interest_rate"`
+	TermMonths    *int          `json:"term_months"`
+	Terms         *string       `json:"terms"`
+	ClosingDate   *finance.Date `json:"closing_date"`
+	ExpiresAt     *time.Time    `json:"expires_at"`
+}
+
+// apply sets the terms given in the request on the offer
+func (req OfferRequest) apply(offer *models.Offer) error {
+	if req.Price != nil {
+		offer.Price = *req.Price
+	}
+	if req.DownPayment != nil {
+		offer.DownPayment = req.DownPayment
+	}
+	if req.EarnestMoney != nil {
+		offer.EarnestMoney = req.EarnestMoney
+	}
+	if req.FinancingType != nil {
+		offer.FinancingType = req.FinancingType
+	}
+	if req.InterestRate != nil {
+		offer.InterestRate = req.InterestRate
+	}
+	if req.TermMonths != nil {
+		offer.TermMonths = req.TermMonths
+	}
+	if req.Terms != nil {
+		terms := strings.TrimSpace(*req.Terms)
+		if len(terms) > maxOfferTermsLen {
+			return fmt.Errorf("terms must be at most %d characters", maxOfferTermsLen)
+		}
+		offer.Terms = &terms
+	}
+	if req.ClosingDate != nil {
+		offer.ClosingDate = req.ClosingDate
+	}
+	// An expiration applies to one offer only, so it is never carried over
+	offer.ExpiresAt = req.ExpiresAt
+	if offer.ExpiresAt != nil && !offer.ExpiresAt.After(time.Now()) {
+		return errors.New("expires_at must be in the future")
+	}
+	return offer.Validate()
+}
+
+// List the offers on a property: all of them for the seller side, and only
+// their own for a buyer
+func GetPropertyOffers(w http.ResponseWriter, r *http.Request) {
+	property, ok := loadProperty(w, r)
+	if !ok {
+		return
+	}
+	user, _ := middleware.GetUserFromContext(r.Context())
+
+	var buyerID *uint
+	if !isSellerSide(user, property) {
+		buyerID = &user.ID
+	}
+
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"offers": models.GetPropertyOffers(property.ID, buyerID),
+		"status": property.Status,
+	})
+}
+
+// Submit an offer on an available property as the authenticated buyer
+func SubmitOffer(w http.ResponseWriter, r *http.Request) {
+	property, ok := loadProperty(w, r)
+	if !ok {
+		return
+	}
+	user, _ := middleware.GetUserFromContext(r.Context())
+	if isSellerSide(user, property) {
+		http.Error(w, "You cannot make an offer on a property you sell", http.StatusForbidden)
+		return
+	}
+
+	var req OfferRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Price == nil {
+		http.Error(w, "price is required", http.StatusBadRequest)
+		return
+	}
+
+	offer := &models.Offer{
+		PropertyID:      property.ID,
+		BuyerID:         user.ID,
+		CreatedByUserID: &user.ID,
+	}
+	if err := req.apply(offer); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := models.SubmitOffer(offer); err != nil {
+		writeOfferError(w, err)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusCreated, offer)
+}
+
+// Show an offer to its buyer or the seller side
+func GetOffer(w http.ResponseWriter, r *http.Request) {
+	offer, _, _, ok := loadOffer(w, r)
+	if !ok {
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, offer)
+}
+
+// Answer a pending offer from the other party with a counter-offer, which
+// is returned
+func CounterOffer(w http.ResponseWriter, r *http.Request) {
+	offer, party, user, ok := loadOffer(w, r)
+	if !ok {
+		return
+	}
+	if party == offer.Party {
+		http.Error(w, "You cannot counter your own offer", http.StatusForbidden)
+		return
+	}
+
+	var req OfferRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	counter := &models.Offer{
+		CreatedByUserID: &user.ID,
+		Price:           offer.Price,
+		DownPayment:     offer.DownPayment,
+		EarnestMoney:    offer.EarnestMoney,
+		FinancingType:   offer.FinancingType,
+		InterestRate:    offer.InterestRate,
+		TermMonths:      offer.TermMonths,
+		Terms:           offer.Terms,
+		ClosingDate:     offer.ClosingDate,
+	}
+	if err := req.apply(counter); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := offer.Counter(counter); err != nil {
+		writeOfferError(w, err)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusCreated, counter)
+}
+
+// Accept a pending offer from the other party. The property goes under
+// contract, so only one offer on it can be accepted at a time.
+func AcceptOffer(w http.ResponseWriter, r *http.Request) {
+	offer, party, _, ok := loadOffer(w, r)
+	if !ok {
+		return
+	}
+	if party == offer.Party {
+		http.Error(w, "You cannot accept your own offer", http.StatusForbidden)
+		return
+	}
+
+	if err := offer.Accept(); err != nil {
+		writeOfferError(w, err)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, offer)
+}
+
+// Turn down a pending offer from the other party
+func RejectOffer(w http.ResponseWriter, r *http.Request) {
+	offer, party, _, ok := loadOffer(w, r)
+	if !ok {
+		return
+	}
+	if party == offer.Party {
+		http.Error(w, "You cannot reject your own offer, withdraw it instead", http.StatusForbidden)
+		return
+	}
+
+	if err := offer.Reject(); err != nil {
+		writeOfferError(w, err)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, offer)
+}
+
+// Withdraw a pending offer the caller's party made or, as the buyer, an
+// accepted one when the deal falls through. The property is then available
+// again.
+func WithdrawOffer(w http.ResponseWriter, r *http.Request) {
+	offer, party, _, ok := loadOffer(w, r)
+	if !ok {
+		return
+	}
+	if offer.Status == models.OfferAccepted && party != models.PartyBuyer {
+		http.Error(w, "Only the buyer can withdraw an accepted offer", http.StatusForbidden)
+		return
+	}
+	if offer.Status != models.OfferAccepted && party != offer.Party {
+		http.Error(w, "You can only withdraw your own offer", http.StatusForbidden)
+		return
+	}
+
+	if err := offer.Withdraw(); err != nil {
+		writeOfferError(w, err)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, offer)
+}
+
+// Record that the deal of an accepted offer closed, which marks the property
+// sold. Only the seller side can close a deal.
+func CloseOffer(w http.ResponseWriter, r *http.Request) {
+	offer, party, _, ok := loadOffer(w, r)
+	if !ok {
+		return
+	}
+	if party != models.PartySeller {
+		http.Error(w, "Only the seller can close a deal", http.StatusForbidden)
+		return
+	}
+
+	if err := offer.Close(); err != nil {
+		writeOfferError(w, err)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, offer)
+}
+
+// GetMyOffers lists the offers the authenticated user made or received as
+// a buyer, newest first
+func GetMyOffers(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"offers": models.GetBuyerOffers(user.ID),
+	})
+}
+
+// isSellerSide reports whether the user negotiates for the seller of the
+// property: staff who can update any property, and the user who submitted
+// it
+func isSellerSide(user *middleware.UserContext, property *models.Property) bool {
+	if user.Can(middleware.PermissionUpdateProperty) {
+		return true
+	}
+	return property.CreatedByUserID != nil && *property.CreatedByUserID == user.ID
+}
+
+// loadOffer loads the offer named by the route and the party the caller
+// negotiates for. Only the buyer and the seller side may see an offer. It
+// writes an error response and returns false when that fails.
+func loadOffer(w http.ResponseWriter, r *http.Request) (*models.Offer, string, *middleware.UserContext, bool) {
+	ID, err := strconv.ParseUint(mux.Vars(r)["OfferId"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid offer ID", http.StatusBadRequest)
+		return nil, "", nil, false
+	}
+
+	offer, err := models.GetOfferById(uint(ID))
+	if err != nil {
+		http.Error(w, "Offer not found", http.StatusNotFound)
+		return nil, "", nil, false
+	}
+
+	user, _ := middleware.GetUserFromContext(r.Context())
+	property, _ := models.GetPropertyById(int64(offer.PropertyID))
+	switch {
+	case property.ID != 0 && isSellerSide(user, property):
+		return offer, models.PartySeller, user, true
+	case offer.BuyerID == user.ID:
+		return offer, models.PartyBuyer, user, true
+	}
+	// Don't reveal offers to anybody else
+	http.Error(w, "Offer not found", http.StatusNotFound)
+	return nil, "", nil, false
+}
+
+// writeOfferError answers a failed offer transition
+func writeOfferError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, models.ErrOfferNotPending):
+		http.Error(w, "Offer is no longer open", http.StatusConflict)
+	case errors.Is(err, models.ErrOfferNotAccepted):
+		http.Error(w, "Offer has not been accepted", http.StatusConflict)
+	case errors.Is(err, models.ErrOfferExpired):
+		http.Error(w, "Offer has expired", http.StatusConflict)
+	case errors.Is(err, models.ErrPropertyNotAvailable):
+		http.Error(w, "Property is not available for offers", http.StatusConflict)
+	default:
+		http.Error(w, "Failed to save offer", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,196 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"api/pkg/middleware"
+	"api/pkg/models"
+	"api/pkg/utils"
+)
+
+// The part of the user a profile patch applies to
+type Profile struct {
+	Name                    *string                        `json:"name"`
+	Phone                   *string                        `json:"phone"`
+	Company                 *string                        `json:"company"`
+	AvatarURL               *string                        `json:"avatar_url"`
+	NotificationPreferences models.NotificationPreferences `json:"notification_preferences"`
+}
+
+// Request structure for changing the password
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// Request structure for closing the account
+type CloseAccountRequest struct {
+	Password string `json:"password"`
+}
+
+// Show the authenticated user's account
+func GetMe(w http.ResponseWriter, r *http.Request) {
+	user, ok := loadCurrentUser(w, r)
+	if !ok {
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, user)
+}
+
+// Update the authenticated user's profile with a JSON Merge Patch (RFC 7396):
+// only the fields present change and fields set to null are cleared. Email,
+// roles and security settings have their own endpoints.
+func PatchMe(w http.ResponseWriter, r *http.Request) {
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	user, ok := loadCurrentUser(w, r)
+	if !ok {
+		return
+	}
+
+	current, err := json.Marshal(Profile{
+		Name:                    user.Name,
+		Phone:                   user.Phone,
+		Company:                 user.Company,
+		AvatarURL:               user.AvatarURL,
+		NotificationPreferences: user.NotificationPreferences,
+	})
+	if err != nil {
+		http.Error(w, "Failed to encode profile", http.StatusInternalServerError)
+		return
+	}
+
+	patched, err := utils.MergePatch(current, patch)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var profile Profile
+	decoder := json.NewDecoder(bytes.NewReader(patched))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&profile); err != nil {
+		http.Error(w, "Invalid profile: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user.Name = profile.Name
+	user.Phone = profile.Phone
+	user.Company = profile.Company
+	user.AvatarURL = profile.AvatarURL
+	user.NotificationPreferences = profile.NotificationPreferences
+
+	if err := user.ValidateProfile(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := user.UpdateProfile(); err != nil {
+		http.Error(w, "Failed to update profile", http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, user)
+}
+
+// Change the password after checking the current one. Other sessions are
+// signed out; the response carries new tokens for this one.
+func ChangePassword(w http.ResponseWriter, r *http.Request) {
+	var req ChangePasswordRequest
+	utils.ParseBody(r, &req)
+
+	if req.CurrentPassword == "" || req.NewPassword == "" {
+		http.Error(w, "Current and new password are required", http.StatusBadRequest)
+		return
+	}
+	if len(req.NewPassword) < minPasswordLength {
+		http.Error(w, fmt.Sprintf("Password must be at least %d characters", minPasswordLength), http.StatusBadRequest)
+		return
+	}
+
+	user, ok := loadCurrentUser(w, r)
+	if !ok {
+		return
+	}
+
+	if !checkCurrentPassword(w, user, req.CurrentPassword) {
+		return
+	}
+
+	if err := user.UpdatePassword(req.NewPassword); err != nil {
+		http.Error(w, "Failed to update password", http.StatusInternalServerError)
+		return
+	}
+
+	if err := models.RevokeUserTokens(user.ID); err != nil {
+		fmt.Println("failed to revoke tokens after password change:", err)
+	}
+
+	current, _ := middleware.GetUserFromContext(r.Context())
+	writeAuthResponse(w, user, http.StatusOK, current.TwoFactor)
+}
+
+// Close the authenticated user's account after confirming the password
+func DeleteMe(w http.ResponseWriter, r *http.Request) {
+	var req CloseAccountRequest
+	utils.ParseBody(r, &req)
+
+	if req.Password == "" {
+		http.Error(w, "Password is required", http.StatusBadRequest)
+		return
+	}
+
+	user, ok := loadCurrentUser(w, r)
+	if !ok {
+		return
+	}
+
+	if !checkCurrentPassword(w, user, req.Password) {
+		return
+	}
+
+	if err := user.Close(); err != nil {
+		if errors.Is(err, models.ErrLastAdmin) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		http.Error(w, "Failed to close account", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkCurrentPassword confirms a sensitive change with the user's password.
+// Wrong guesses count towards the login lockout, so a stolen session cannot
+// be used to find the password. It writes an error response and returns
+// false when the password is not accepted.
+func checkCurrentPassword(w http.ResponseWriter, user *models.User, password string) bool {
+	if wait := user.LoginRetryAfter(); wait > 0 {
+		writeTooManyAttempts(w, wait, "Too many failed password attempts, please try again later")
+		return false
+	}
+
+	if !user.CheckPassword(password) {
+		if err := user.RecordFailedLogin(); err != nil {
+			fmt.Println("failed to record failed login:", err)
+		}
+		http.Error(w, "Incorrect password", http.StatusForbidden)
+		return false
+	}
+
+	if err := user.ResetFailedLogins(); err != nil {
+		fmt.Println("failed to reset failed logins:", err)
+	}
+	return true
+}
@@ -2,11 +2,16 @@
 package controllers
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"strconv"
 
+	"api/pkg/address"
+	"api/pkg/middleware"
 	"api/pkg/models"
 	"api/pkg/utils"
 
@@ -16,41 +21,34 @@ import (
 var NewProperty models.Property
 
 func GetProperties(w http.ResponseWriter, r *http.Request) {
-	// Get query parameters for page and pageSize
-	pageStr := r.URL.Query().Get("page")
-	pageSizeStr := r.URL.Query().Get("pageSize")
-	soldParam := r.URL.Query().Get("sold")
+	page, pageSize, err := parsePagination(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	searchQuery := r.URL.Query().Get("search")
 
-	// Default values if not provided
-	page := 1
-	pageSize := 10
-	var sold *bool
-
-	var err error
-	if pageStr != "" {
-		page, err = strconv.Atoi(pageStr)
-		if err != nil {
-			http.Error(w, "Invalid page parameter", http.StatusBadRequest)
-			return
-		}
+	// Parse structured filters (price_min, bedrooms_min, property_type, sold, sort, ...)
+	filter, err := models.ParsePropertyFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	if pageSizeStr != "" {
-		pageSize, err = strconv.Atoi(pageSizeStr)
-		if err != nil {
-			http.Error(w, "Invalid pageSize parameter", http.StatusBadRequest)
-			return
-		}
+	// Search results are ranked by relevance unless another sort is requested
+	if searchQuery != "" && r.URL.Query().Get("sort") == "" {
+		filter.Sort = "relevance"
+	}
+	if filter.Sort == "relevance" && searchQuery == "" {
+		http.Error(w, "sort=relevance requires a search parameter", http.StatusBadRequest)
+		return
 	}
 
-	if soldParam != "" {
-		soldValue, err := strconv.ParseBool(soldParam)
-		if err != nil {
-			http.Error(w, "Invalid sold parameter", http.StatusBadRequest)
-			return
-		}
-		sold = &soldValue
+	// Cursor mode: ?cursor= (empty for the first page) switches to keyset
+	// pagination, which stays stable while properties are being added
+	if r.URL.Query().Has("cursor") {
+		getPropertiesByCursor(w, r, page, pageSize, searchQuery, filter)
+		return
 	}
 
 	// Calculate offset
@@ -62,10 +60,10 @@ func GetProperties(w http.ResponseWriter, r *http.Request) {
 
 	if searchQuery != "" {
 		// Search across all properties
-		newProperties, total = models.SearchProperties(searchQuery, pageSize, offset, sold)
+		newProperties, total = models.SearchProperties(searchQuery, pageSize, offset, filter)
 	} else {
 		// Get paginated properties normally
-		newProperties, total = models.GetPaginatedProperties(pageSize, offset, sold)
+		newProperties, total = models.GetPaginatedProperties(pageSize, offset, filter)
 	}
 
 	// Create response with properties and total count
@@ -75,6 +73,49 @@ func GetProperties(w http.ResponseWriter, r *http.Request) {
 		"page":       page,
 		"pageSize":   pageSize,
 		"search":     searchQuery,
+		"sort":       filter.Sort,
+		"order":      filter.Order,
+	}
+
+	res, err := json.Marshal(response)
+	if err != nil {
+		http.Error(w, "Failed to encode properties as JSON", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(res)
+}
+
+func getPropertiesByCursor(w http.ResponseWriter, r *http.Request, page int, pageSize int, searchQuery string, filter *models.PropertyFilter) {
+	if searchQuery != "" {
+		http.Error(w, "Cursor pagination is not supported together with search", http.StatusBadRequest)
+		return
+	}
+
+	if filter.Sort != "created_at" {
+		http.Error(w, "Cursor pagination requires sort=created_at", http.StatusBadRequest)
+		return
+	}
+
+	cursor, err := models.DecodePropertyCursor(r.URL.Query().Get("cursor"))
+	if err != nil {
+		http.Error(w, "Invalid cursor parameter", http.StatusBadRequest)
+		return
+	}
+
+	newProperties, total, next, prev := models.GetPropertiesByCursor(pageSize, cursor, filter)
+
+	response := map[string]interface{}{
+		"properties": newProperties,
+		"total":      total,
+		"page":       page,
+		"pageSize":   pageSize,
+		"nextCursor": next.Encode(),
+		"prevCursor": prev.Encode(),
+		"sort":       filter.Sort,
+		"order":      filter.Order,
 	}
 
 	res, err := json.Marshal(response)
@@ -96,6 +137,17 @@ func GetPropertyById(w http.ResponseWriter, r *http.Request) {
 		fmt.Println("error while parsing")
 	}
 	PropertyDetails, _ := models.GetPropertyById(ID)
+	if PropertyDetails.ID == 0 {
+		http.Error(w, "Property not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("ETag", PropertyDetails.ETag())
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" && PropertyDetails.MatchesETagWeak(ifNoneMatch) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
 	res, _ := json.Marshal(PropertyDetails)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -103,6 +155,13 @@ func GetPropertyById(w http.ResponseWriter, r *http.Request) {
 }
 
 func CreateProperty(w http.ResponseWriter, r *http.Request) {
+	// Anonymous submissions are open, but a signed-in user or API key must
+	// be allowed to create properties
+	if user, ok := middleware.GetUserFromContext(r.Context()); ok && !user.Can(middleware.PermissionCreateProperty) {
+		http.Error(w, "You do not have permission to perform this action", http.StatusForbidden)
+		return
+	}
+
 	PropertyModel := &models.Property{}
 	utils.ParseBody(r, PropertyModel)
 
@@ -110,15 +169,27 @@ func CreateProperty(w http.ResponseWriter, r *http.Request) {
 	if PropertyModel.CreatedBy == nil {
 		defaultCreatedBy := "user"
 		PropertyModel.CreatedBy = &defaultCreatedBy
-	} else {
-		// Validate that CreatedBy is either "user" or "admin"
-		if *PropertyModel.CreatedBy != "user" && *PropertyModel.CreatedBy != "admin" {
-			http.Error(w, "CreatedBy must be either 'user' or 'admin'", http.StatusBadRequest)
-			return
-		}
+	}
+	PropertyModel.ReconcileStatus(nil)
+
+	if err := PropertyModel.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Link the property to the submitting user when signed in
+	PropertyModel.CreatedByUserID = nil
+	if user, ok := middleware.GetUserFromContext(r.Context()); ok && !user.IsAPIKey() {
+		PropertyModel.CreatedByUserID = &user.ID
+	}
+
+	// Split the address into components and geocode it
+	if err := PropertyModel.NormalizeAddress(address.DefaultGeocoder()); err != nil {
+		fmt.Println("failed to geocode address:", err)
 	}
 
 	b := PropertyModel.CreateProperty()
+	ingestLinkedImages(r, b)
 	res, err := json.Marshal(b)
 	if err != nil {
 		panic(err)
@@ -136,7 +207,24 @@ func DeleteProperty(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid property ID", http.StatusBadRequest)
 		return
 	}
-	property := models.DeleteProperty(ID)
+
+	property, _ := models.GetPropertyById(ID)
+	if property.ID == 0 {
+		http.Error(w, "Property not found", http.StatusNotFound)
+		return
+	}
+	if !authorizePropertyChange(w, r, property, middleware.PermissionDeleteProperty) {
+		return
+	}
+	if !checkIfMatch(w, r, property) {
+		return
+	}
+
+	if err := property.DeleteVersioned(); err != nil {
+		writeSaveError(w, r, err)
+		return
+	}
+
 	res, err := json.Marshal(property)
 	if err != nil {
 		http.Error(w, "Failed to encode response as JSON", http.StatusInternalServerError)
@@ -156,13 +244,34 @@ func UpdateProperty(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		fmt.Println("error while parsing")
 	}
-	propertyDetails, db := models.GetPropertyById(ID)
+	propertyDetails, _ := models.GetPropertyById(ID)
+	if propertyDetails.ID == 0 {
+		http.Error(w, "Property not found", http.StatusNotFound)
+		return
+	}
+	if !authorizePropertyChange(w, r, propertyDetails, middleware.PermissionUpdateProperty) {
+		return
+	}
+	if !checkIfMatch(w, r, propertyDetails) {
+		return
+	}
+
+	// A version in the body works like If-Match for clients that cannot set headers
+	if updateProperty.Version != 0 && updateProperty.Version != propertyDetails.Version {
+		http.Error(w, "Property has been modified since it was loaded", http.StatusPreconditionFailed)
+		return
+	}
+
+	addressChanged := propertyDetails.Address != updateProperty.Address
+	previous := &models.Property{Status: propertyDetails.Status, Sold: propertyDetails.Sold}
 
 	propertyDetails.Address = updateProperty.Address
 	propertyDetails.Price = updateProperty.Price
 	propertyDetails.Description = updateProperty.Description
 	propertyDetails.Images = updateProperty.Images
 	propertyDetails.Sold = updateProperty.Sold
+	propertyDetails.Status = updateProperty.Status
+	propertyDetails.ReconcileStatus(previous)
 	propertyDetails.Bedrooms = updateProperty.Bedrooms
 	propertyDetails.Bathrooms = updateProperty.Bathrooms
 	propertyDetails.RentZestimate = updateProperty.RentZestimate
@@ -184,9 +293,6 @@ func UpdateProperty(w http.ResponseWriter, r *http.Request) {
 	propertyDetails.TaxHistory = updateProperty.TaxHistory
 	propertyDetails.MonthlyHoaFee = updateProperty.MonthlyHoaFee
 	propertyDetails.ContactRecipients = updateProperty.ContactRecipients
-	propertyDetails.TransactionDocumentUrl = updateProperty.TransactionDocumentUrl
-	propertyDetails.BenefitSheetUrl = updateProperty.BenefitSheetUrl
-	propertyDetails.DocsUrl = updateProperty.DocsUrl
 	propertyDetails.Escrow = updateProperty.Escrow
 	propertyDetails.DealHolder = updateProperty.DealHolder
 	propertyDetails.DealHolderPhone = updateProperty.DealHolderPhone
@@ -197,24 +303,281 @@ func UpdateProperty(w http.ResponseWriter, r *http.Request) {
 	propertyDetails.PriceBreakDown = updateProperty.PriceBreakDown
 	propertyDetails.AdditionalBenefits = updateProperty.AdditionalBenefits
 	propertyDetails.ReApiId = updateProperty.ReApiId
+	propertyDetails.County = updateProperty.County
 
-	// Update CreatedBy if provided and valid
+	// Keep the stored coordinates unless new ones are supplied or the address
+	// moved, in which case they are looked up again
+	if updateProperty.Latitude != nil && updateProperty.Longitude != nil {
+		propertyDetails.Latitude = updateProperty.Latitude
+		propertyDetails.Longitude = updateProperty.Longitude
+	} else if addressChanged {
+		propertyDetails.Latitude = nil
+		propertyDetails.Longitude = nil
+	}
+
+	if err := propertyDetails.NormalizeAddress(address.DefaultGeocoder()); err != nil {
+		fmt.Println("failed to geocode address:", err)
+	}
+
+	// Update CreatedBy if provided
 	if updateProperty.CreatedBy != nil {
-		if *updateProperty.CreatedBy == "user" || *updateProperty.CreatedBy == "admin" {
-			propertyDetails.CreatedBy = updateProperty.CreatedBy
-		} else {
-			http.Error(w, "CreatedBy must be either 'user' or 'admin'", http.StatusBadRequest)
-			return
-		}
+		propertyDetails.CreatedBy = updateProperty.CreatedBy
 	}
 
-	db.Save(&propertyDetails)
+	if err := propertyDetails.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !checkStatusChange(w, previous, propertyDetails) {
+		return
+	}
+
+	if err := propertyDetails.SaveVersioned(); err != nil {
+		writeSaveError(w, r, err)
+		return
+	}
+	ingestLinkedImages(r, propertyDetails)
+
 	res, err := json.Marshal(propertyDetails)
 	if err != nil {
 		panic(err)
 	}
 
+	w.Header().Set("ETag", propertyDetails.ETag())
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	w.Write(res)
 }
+
+// Fields of the property JSON that a patch may not touch: bookkeeping
+// columns, the address components derived from address, and search output
+var propertyReadOnlyFields = []string{
+	"ID", "CreatedAt", "UpdatedAt", "DeletedAt", "created_by_user_id",
+	"street", "unit", "city", "state", "zip",
+	"relevance", "distance", "highlights",
+}
+
+// PatchProperty applies a JSON Merge Patch (RFC 7396) to a property: only
+// the fields present in the body change, and fields set to null are cleared
+func PatchProperty(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	PropertyId := vars["PropertyId"]
+	ID, err := strconv.ParseInt(PropertyId, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid property ID", http.StatusBadRequest)
+		return
+	}
+
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	var changes map[string]json.RawMessage
+	if err := json.Unmarshal(patch, &changes); err != nil {
+		http.Error(w, "Request body must be a JSON object", http.StatusBadRequest)
+		return
+	}
+	for _, field := range propertyReadOnlyFields {
+		if _, ok := changes[field]; ok {
+			http.Error(w, fmt.Sprintf("Field '%s' cannot be changed", field), http.StatusBadRequest)
+			return
+		}
+	}
+
+	propertyDetails, _ := models.GetPropertyById(ID)
+	if propertyDetails.ID == 0 {
+		http.Error(w, "Property not found", http.StatusNotFound)
+		return
+	}
+	if !authorizePropertyChange(w, r, propertyDetails, middleware.PermissionUpdateProperty) {
+		return
+	}
+	if !checkIfMatch(w, r, propertyDetails) {
+		return
+	}
+
+	// A version in the patch works like If-Match and is not itself written
+	if raw, ok := changes["version"]; ok {
+		var version uint
+		if err := json.Unmarshal(raw, &version); err != nil || version != propertyDetails.Version {
+			http.Error(w, "Property has been modified since it was loaded", http.StatusPreconditionFailed)
+			return
+		}
+	}
+
+	current, err := json.Marshal(propertyDetails)
+	if err != nil {
+		http.Error(w, "Failed to encode property", http.StatusInternalServerError)
+		return
+	}
+
+	patched, err := utils.MergePatch(current, patch)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var patchedProperty models.Property
+	decoder := json.NewDecoder(bytes.NewReader(patched))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&patchedProperty); err != nil {
+		http.Error(w, "Invalid property: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	patchedProperty.Model = propertyDetails.Model
+	patchedProperty.Version = propertyDetails.Version
+	patchedProperty.CreatedByUserID = propertyDetails.CreatedByUserID
+	patchedProperty.ReconcileStatus(propertyDetails)
+
+	if err := patchedProperty.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !checkStatusChange(w, propertyDetails, &patchedProperty) {
+		return
+	}
+
+	// A new address invalidates the coordinates unless the patch sets them
+	_, coordinatesPatched := changes["latitude"]
+	if patchedProperty.Address != propertyDetails.Address && !coordinatesPatched {
+		patchedProperty.Latitude = nil
+		patchedProperty.Longitude = nil
+	}
+
+	if err := patchedProperty.NormalizeAddress(address.DefaultGeocoder()); err != nil {
+		fmt.Println("failed to geocode address:", err)
+	}
+
+	if err := patchedProperty.SaveVersioned(); err != nil {
+		writeSaveError(w, r, err)
+		return
+	}
+	ingestLinkedImages(r, &patchedProperty)
+
+	res, err := json.Marshal(patchedProperty)
+	if err != nil {
+		http.Error(w, "Failed to encode response as JSON", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", patchedProperty.ETag())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(res)
+}
+
+// authorizePropertyChange checks that the user may modify property: staff
+// roles hold permission for every property, regular users only for the
+// ones they submitted. It writes 403 and returns false otherwise.
+func authorizePropertyChange(w http.ResponseWriter, r *http.Request, property *models.Property, permission middleware.Permission) bool {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return false
+	}
+	if user.Can(permission) {
+		return true
+	}
+	if property.CreatedByUserID != nil && *property.CreatedByUserID == user.ID {
+		return true
+	}
+	http.Error(w, "You can only modify properties you submitted", http.StatusForbidden)
+	return false
+}
+
+// checkStatusChange refuses to move a property away from under_contract by
+// hand while an offer on it is accepted: withdrawing or closing the offer
+// does that, and keeps the offers in step. It writes 409 and returns false.
+func checkStatusChange(w http.ResponseWriter, previous *models.Property, property *models.Property) bool {
+	if previous.Status != models.PropertyUnderContract || property.Status == previous.Status {
+		return true
+	}
+
+	accepted, err := models.HasAcceptedOffer(property.ID)
+	if err != nil {
+		http.Error(w, "Failed to check the property's offers", http.StatusInternalServerError)
+		return false
+	}
+	if accepted {
+		http.Error(w, "Property is under contract through an accepted offer; withdraw or close the offer instead", http.StatusConflict)
+		return false
+	}
+	return true
+}
+
+// ingestLinkedImages has the images a save linked by URL downloaded and
+// resized, when the caller is staff. Links from anyone else stay plain URLs,
+// so that submissions cannot make the server fetch arbitrary addresses.
+func ingestLinkedImages(r *http.Request, property *models.Property) {
+	if user, ok := middleware.GetUserFromContext(r.Context()); ok && user.Can(middleware.PermissionUpdateProperty) {
+		property.ProcessLinkedImages()
+	}
+}
+
+// GetMyProperties lists the properties submitted by the authenticated user,
+// accepting the same filters and pagination as GetProperties
+func GetMyProperties(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	page, pageSize, err := parsePagination(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filter, err := models.ParsePropertyFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if filter.Sort == "relevance" {
+		http.Error(w, "sort=relevance requires a search parameter, which this endpoint does not support", http.StatusBadRequest)
+		return
+	}
+	filter.CreatedByUserID = &user.ID
+
+	properties, total := models.GetPaginatedProperties(pageSize, (page-1)*pageSize, filter)
+
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"properties": properties,
+		"total":      total,
+		"page":       page,
+		"pageSize":   pageSize,
+		"sort":       filter.Sort,
+		"order":      filter.Order,
+	})
+}
+
+// checkIfMatch enforces an If-Match precondition against the property's
+// current version, answering 412 Precondition Failed when the client's copy
+// is stale. Requests without If-Match are let through.
+func checkIfMatch(w http.ResponseWriter, r *http.Request, property *models.Property) bool {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" || property.MatchesETag(ifMatch) {
+		return true
+	}
+	w.Header().Set("ETag", property.ETag())
+	http.Error(w, "Property has been modified since it was loaded", http.StatusPreconditionFailed)
+	return false
+}
+
+// writeSaveError reports a failed versioned write. Losing the race to
+// another writer is a failed precondition when the client sent one, and a
+// conflict to retry otherwise.
+func writeSaveError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, models.ErrVersionConflict) {
+		if r.Header.Get("If-Match") != "" {
+			http.Error(w, "Property has been modified since it was loaded", http.StatusPreconditionFailed)
+		} else {
+			http.Error(w, "Property was modified concurrently, please retry", http.StatusConflict)
+		}
+		return
+	}
+	http.Error(w, "Failed to save property", http.StatusInternalServerError)
+}
@@ -0,0 +1,406 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"api/pkg/config"
+	"api/pkg/middleware"
+	"api/pkg/models"
+	"api/pkg/storage"
+	"api/pkg/utils"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	maxDocumentUploadBytes = 25 << 20
+	documentLinkTTL        = 5 * time.Minute
+)
+
+// Document formats accepted for upload, by file extension. The content type
+// sniffed from the file must match too, so a renamed file is rejected.
+var documentFormats = map[string]struct {
+	contentType string
+	sniffed     string
+}{
+	".pdf":  {"application/pdf", "application/pdf"},
+	".docx": {"application/vnd.openxmlformats-officedocument.wordprocessingml.document", "application/zip"},
+	".xlsx": {"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", "application/zip"},
+	".csv":  {"text/csv", "text/plain"},
+	".txt":  {"text/plain", "text/plain"},
+	".jpg":  {"image/jpeg", "image/jpeg"},
+	".jpeg": {"image/jpeg", "image/jpeg"},
+	".png":  {"image/png", "image/png"},
+}
+
+// Request structure for changing a document's details
+type UpdateDocumentRequest struct {
+	Type       *string `json:"type"`
+	Visibility *string `json:"visibility"`
+	Name       *string `json:"name"`
+}
+
+// Request structure for signing a property's NDA
+type SignNDARequest struct {
+	SignerName string `json:"signer_name"`
+	Agree      bool   `json:"agree"`
+}
+
+// List the documents of a property the caller may see: public ones for
+// everybody, NDA ones once the user signed the property's NDA, and all of
+// them for staff and the user who submitted the property
+func GetPropertyDocuments(w http.ResponseWriter, r *http.Request) {
+	property, ok := loadProperty(w, r)
+	if !ok {
+		return
+	}
+
+	access := documentAccess(r, property)
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"documents": models.GetPropertyDocuments(property.ID, access),
+		"access":    access,
+	})
+}
+
+// Upload a document to a property as multipart/form-data: the file in the
+// "file" field, and "type", "visibility" (staff by default) and "name" (the
+// file name by default) fields
+func UploadPropertyDocument(w http.ResponseWriter, r *http.Request) {
+	property, ok := loadProperty(w, r)
+	if !ok {
+		return
+	}
+	if !authorizePropertyChange(w, r, property, middleware.PermissionUpdateProperty) {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxDocumentUploadBytes+(1<<20))
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("Documents can be at most %d MB", maxDocumentUploadBytes>>20), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Request must be multipart/form-data with the document in the file field", http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	files := r.MultipartForm.File["file"]
+	if len(files) != 1 {
+		http.Error(w, "Send exactly one document in the file field", http.StatusBadRequest)
+		return
+	}
+	file := files[0]
+
+	f, err := file.Open()
+	if err != nil {
+		http.Error(w, "Failed to read the document", http.StatusBadRequest)
+		return
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, maxDocumentUploadBytes+1))
+	if err != nil {
+		http.Error(w, "Failed to read the document", http.StatusBadRequest)
+		return
+	}
+	if len(data) > maxDocumentUploadBytes {
+		http.Error(w, fmt.Sprintf("Documents can be at most %d MB", maxDocumentUploadBytes>>20), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	fileName := filepath.Base(file.Filename)
+	extension := strings.ToLower(filepath.Ext(fileName))
+	format, ok := documentFormats[extension]
+	if !ok || !strings.HasPrefix(http.DetectContentType(data), format.sniffed) {
+		http.Error(w, "Documents must be PDF, Word (.docx), Excel (.xlsx), CSV, text, JPEG or PNG files", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	document := &models.PropertyDocument{
+		PropertyID: property.ID,
+		Type:       r.FormValue("type"),
+		Visibility: r.FormValue("visibility"),
+		Name:       strings.TrimSpace(r.FormValue("name")),
+	}
+	if document.Visibility == "" {
+		document.Visibility = models.VisibilityStaff
+	}
+	if document.Name == "" {
+		document.Name = strings.TrimSuffix(fileName, filepath.Ext(fileName))
+	}
+	if err := document.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	key, err := models.StoreDocumentFile(r.Context(), property.ID, extension, format.contentType, bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		fmt.Println("failed to store document:", err)
+		http.Error(w, "Failed to store the document", http.StatusBadGateway)
+		return
+	}
+
+	size := int64(len(data))
+	document.FileName = &fileName
+	document.ContentType = &format.contentType
+	document.Size = &size
+	document.StorageKey = &key
+	if user, ok := middleware.GetUserFromContext(r.Context()); ok && !user.IsAPIKey() {
+		document.UploadedByUserID = &user.ID
+	}
+
+	if err := document.Save(); err != nil {
+		storage.Default().Delete(r.Context(), key)
+		http.Error(w, "Failed to save document", http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusCreated, document)
+}
+
+// Change the type, visibility or name of a document
+func UpdatePropertyDocument(w http.ResponseWriter, r *http.Request) {
+	property, document, ok := loadPropertyDocument(w, r)
+	if !ok {
+		return
+	}
+	if !authorizePropertyChange(w, r, property, middleware.PermissionUpdateProperty) {
+		return
+	}
+
+	var req UpdateDocumentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Type != nil {
+		document.Type = *req.Type
+	}
+	if req.Visibility != nil {
+		document.Visibility = *req.Visibility
+	}
+	if req.Name != nil {
+		document.Name = strings.TrimSpace(*req.Name)
+	}
+	if err := document.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := document.Save(); err != nil {
+		http.Error(w, "Failed to save document", http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, document)
+}
+
+// Remove a document from its property, deleting the file if it was uploaded
+func DeletePropertyDocument(w http.ResponseWriter, r *http.Request) {
+	property, document, ok := loadPropertyDocument(w, r)
+	if !ok {
+		return
+	}
+	if !authorizePropertyChange(w, r, property, middleware.PermissionUpdateProperty) {
+		return
+	}
+
+	if err := document.Delete(); err != nil {
+		http.Error(w, "Failed to delete document", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Create a short-lived signed link to download a document the caller may
+// see. Anyone holding the link can use it until it expires.
+func GetPropertyDocumentLink(w http.ResponseWriter, r *http.Request) {
+	property, document, ok := loadPropertyDocument(w, r)
+	if !ok {
+		return
+	}
+
+	if !document.VisibleTo(documentAccess(r, property)) {
+		if document.Visibility == models.VisibilityNDA {
+			http.Error(w, "Sign the property's NDA to download this document", http.StatusForbidden)
+			return
+		}
+		http.Error(w, "Document not found", http.StatusNotFound)
+		return
+	}
+
+	var userID uint
+	if user, ok := middleware.GetUserFromContext(r.Context()); ok {
+		userID = user.ID
+	}
+	token, err := utils.GenerateDownloadToken(document.ID, userID, documentLinkTTL)
+	if err != nil {
+		http.Error(w, "Failed to create download link", http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"url":        config.APIBaseURL() + "/documents/download?token=" + token,
+		"expires_at": time.Now().Add(documentLinkTTL).UTC(),
+	})
+}
+
+// Download a document with a signed link. Uploaded files are streamed,
+// links to files hosted elsewhere are redirected to.
+func DownloadDocument(w http.ResponseWriter, r *http.Request) {
+	claims, err := utils.ValidateDownloadToken(r.URL.Query().Get("token"))
+	if err != nil {
+		http.Error(w, "Download link is invalid or has expired", http.StatusForbidden)
+		return
+	}
+
+	document, err := models.GetDocument(claims.DocumentID)
+	if err != nil {
+		http.Error(w, "Document not found", http.StatusNotFound)
+		return
+	}
+	// Documents of deleted properties go with them
+	if property, _ := models.GetPropertyById(int64(document.PropertyID)); property.ID == 0 {
+		http.Error(w, "Document not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "private, no-store")
+	if document.IsLink() {
+		http.Redirect(w, r, *document.URL, http.StatusFound)
+		return
+	}
+
+	body, err := document.Open(r.Context())
+	if errors.Is(err, storage.ErrNotFound) || errors.Is(err, models.ErrDocumentNotFound) {
+		http.Error(w, "Document not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		fmt.Println("failed to open document:", err)
+		http.Error(w, "Failed to read the document", http.StatusBadGateway)
+		return
+	}
+	defer body.Close()
+
+	fileName := document.Name
+	if document.FileName != nil {
+		fileName = *document.FileName
+	}
+	if document.ContentType != nil {
+		w.Header().Set("Content-Type", *document.ContentType)
+	}
+	if document.Size != nil {
+		w.Header().Set("Content-Length", strconv.FormatInt(*document.Size, 10))
+	}
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": fileName}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, body)
+}
+
+// Show the authenticated user's signature of a property's NDA
+func GetPropertyNDA(w http.ResponseWriter, r *http.Request) {
+	property, ok := loadProperty(w, r)
+	if !ok {
+		return
+	}
+	user, _ := middleware.GetUserFromContext(r.Context())
+
+	signature, err := models.GetNDASignature(property.ID, user.ID)
+	if err != nil {
+		http.Error(w, "You have not signed this property's NDA", http.StatusNotFound)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, signature)
+}
+
+// Sign a property's NDA, which gives the user access to its NDA documents
+func SignPropertyNDA(w http.ResponseWriter, r *http.Request) {
+	property, ok := loadProperty(w, r)
+	if !ok {
+		return
+	}
+	user, _ := middleware.GetUserFromContext(r.Context())
+
+	var req SignNDARequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.SignerName = strings.TrimSpace(req.SignerName)
+	if req.SignerName == "" || len(req.SignerName) > 255 {
+		http.Error(w, "signer_name is required and must be at most 255 characters", http.StatusBadRequest)
+		return
+	}
+	if !req.Agree {
+		http.Error(w, "agree must be true to sign the NDA", http.StatusBadRequest)
+		return
+	}
+
+	signature, err := models.SignNDA(property.ID, user.ID, req.SignerName, utils.ClientIP(r))
+	if err != nil {
+		http.Error(w, "Failed to sign the NDA", http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusCreated, signature)
+}
+
+// documentAccess returns the most restricted document visibility the caller
+// may see on property
+func documentAccess(r *http.Request, property *models.Property) string {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		return models.VisibilityPublic
+	}
+	if user.Can(middleware.PermissionUpdateProperty) {
+		return models.VisibilityStaff
+	}
+	if user.IsAPIKey() {
+		return models.VisibilityPublic
+	}
+	if property.CreatedByUserID != nil && *property.CreatedByUserID == user.ID {
+		return models.VisibilityStaff
+	}
+	if models.HasSignedNDA(property.ID, user.ID) {
+		return models.VisibilityNDA
+	}
+	return models.VisibilityPublic
+}
+
+// loadPropertyDocument loads the property and the document named by the
+// route. It writes an error response and returns false when that fails.
+func loadPropertyDocument(w http.ResponseWriter, r *http.Request) (*models.Property, *models.PropertyDocument, bool) {
+	property, ok := loadProperty(w, r)
+	if !ok {
+		return nil, nil, false
+	}
+
+	ID, err := strconv.ParseUint(mux.Vars(r)["DocumentId"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid document ID", http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	document, err := models.GetPropertyDocument(property.ID, uint(ID))
+	if err != nil {
+		http.Error(w, "Document not found", http.StatusNotFound)
+		return nil, nil, false
+	}
+	return property, document, true
+}
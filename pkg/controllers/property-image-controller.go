@@ -0,0 +1,256 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"time"
+
+	"api/pkg/imaging"
+	"api/pkg/middleware"
+	"api/pkg/models"
+	"api/pkg/storage"
+	"api/pkg/utils"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	maxImageUploadBytes = 10 << 20 // per file
+	maxImagesPerUpload  = 20
+)
+
+// Image formats accepted for upload, by sniffed content type
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// Request structure for reordering the images of a property
+type ReorderImagesRequest struct {
+	ImageIDs []uint `json:"image_ids"`
+}
+
+// Upload photos of a property as multipart/form-data, one or more files in
+// the "images" field. They are added after the existing images.
+func UploadPropertyImages(w http.ResponseWriter, r *http.Request) {
+	property, ok := loadProperty(w, r)
+	if !ok {
+		return
+	}
+	if !authorizePropertyChange(w, r, property, middleware.PermissionUpdateProperty) {
+		return
+	}
+	if !checkIfMatch(w, r, property) {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImagesPerUpload*maxImageUploadBytes+(1<<20))
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "Upload is too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Request must be multipart/form-data with files in the images field", http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	files := append(r.MultipartForm.File["images"], r.MultipartForm.File["image"]...)
+	if len(files) == 0 {
+		http.Error(w, "No files in the images field", http.StatusBadRequest)
+		return
+	}
+	if len(files) > maxImagesPerUpload {
+		http.Error(w, fmt.Sprintf("At most %d images can be uploaded at once", maxImagesPerUpload), http.StatusBadRequest)
+		return
+	}
+	if len(property.Images)+len(files) > models.MaxPropertyImages {
+		http.Error(w, fmt.Sprintf("A property can have at most %d images", models.MaxPropertyImages), http.StatusBadRequest)
+		return
+	}
+
+	var uploaded []models.PropertyImage
+	for _, file := range files {
+		image, status, err := storeImage(r.Context(), property.ID, file)
+		if err != nil {
+			deleteStoredImages(uploaded)
+			http.Error(w, err.Error(), status)
+			return
+		}
+		uploaded = append(uploaded, *image)
+	}
+
+	if err := property.AddImages(uploaded); err != nil {
+		deleteStoredImages(uploaded)
+		writeSaveError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", property.ETag())
+	utils.RespondJSON(w, http.StatusCreated, map[string]interface{}{
+		"images": property.Images,
+	})
+}
+
+// storeImage checks an uploaded file and puts it in storage. On failure it
+// returns the status code to respond with.
+func storeImage(ctx context.Context, propertyID uint, file *multipart.FileHeader) (*models.PropertyImage, int, error) {
+	if file.Size > maxImageUploadBytes {
+		return nil, http.StatusRequestEntityTooLarge, fmt.Errorf("%s is larger than %d MB", file.Filename, maxImageUploadBytes>>20)
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("failed to read %s", file.Filename)
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, maxImageUploadBytes+1))
+	if err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("failed to read %s", file.Filename)
+	}
+	if len(data) > maxImageUploadBytes {
+		return nil, http.StatusRequestEntityTooLarge, fmt.Errorf("%s is larger than %d MB", file.Filename, maxImageUploadBytes>>20)
+	}
+
+	// Trust the bytes, not the client's declared type
+	contentType := http.DetectContentType(data)
+	extension, ok := imageExtensions[contentType]
+	if !ok {
+		return nil, http.StatusUnsupportedMediaType, fmt.Errorf("%s is not a JPEG, PNG, GIF or WebP image", file.Filename)
+	}
+
+	image, err := models.StoreUploadedImage(ctx, propertyID, contentType, extension, data)
+	switch {
+	case errors.Is(err, imaging.ErrTooLarge):
+		return nil, http.StatusRequestEntityTooLarge, fmt.Errorf("%s has more than %d megapixels", file.Filename, imaging.MaxPixels/1_000_000)
+	case errors.Is(err, imaging.ErrMalformed):
+		return nil, http.StatusBadRequest, fmt.Errorf("%s is not a valid image", file.Filename)
+	case err != nil:
+		fmt.Println("failed to store image:", err)
+		return nil, http.StatusBadGateway, fmt.Errorf("failed to store %s", file.Filename)
+	}
+	return image, 0, nil
+}
+
+// deleteStoredImages removes files uploaded by a request that then failed
+func deleteStoredImages(images []models.PropertyImage) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	for _, image := range images {
+		if image.StorageKey != nil {
+			storage.Default().Delete(ctx, *image.StorageKey)
+		}
+		for _, variant := range image.Variants {
+			storage.Default().Delete(ctx, variant.Key)
+		}
+	}
+}
+
+// Put the images of a property in a new order
+func ReorderPropertyImages(w http.ResponseWriter, r *http.Request) {
+	property, ok := loadProperty(w, r)
+	if !ok {
+		return
+	}
+	if !authorizePropertyChange(w, r, property, middleware.PermissionUpdateProperty) {
+		return
+	}
+	if !checkIfMatch(w, r, property) {
+		return
+	}
+
+	var req ReorderImagesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := property.ReorderImages(req.ImageIDs); err != nil {
+		if errors.Is(err, models.ErrInvalidImageOrder) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeSaveError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", property.ETag())
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"images": property.Images,
+	})
+}
+
+// Make an image the cover photo of its property
+func SetPropertyCoverImage(w http.ResponseWriter, r *http.Request) {
+	property, imageID, ok := loadPropertyImage(w, r)
+	if !ok {
+		return
+	}
+
+	if err := property.SetCoverImage(imageID); err != nil {
+		writeImageError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", property.ETag())
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"images": property.Images,
+	})
+}
+
+// Remove an image from its property, deleting the file if it was uploaded
+func DeletePropertyImage(w http.ResponseWriter, r *http.Request) {
+	property, imageID, ok := loadPropertyImage(w, r)
+	if !ok {
+		return
+	}
+
+	if err := property.RemoveImage(imageID); err != nil {
+		writeImageError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", property.ETag())
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// loadPropertyImage loads the property named by the route, checks that the
+// user may change it and parses the ImageId route variable. It writes an
+// error response and returns false when that fails.
+func loadPropertyImage(w http.ResponseWriter, r *http.Request) (*models.Property, uint, bool) {
+	property, ok := loadProperty(w, r)
+	if !ok {
+		return nil, 0, false
+	}
+	if !authorizePropertyChange(w, r, property, middleware.PermissionUpdateProperty) {
+		return nil, 0, false
+	}
+	if !checkIfMatch(w, r, property) {
+		return nil, 0, false
+	}
+
+	imageID, err := strconv.ParseUint(mux.Vars(r)["ImageId"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid image ID", http.StatusBadRequest)
+		return nil, 0, false
+	}
+	return property, uint(imageID), true
+}
+
+func writeImageError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, models.ErrImageNotFound) {
+		http.Error(w, "Image not found", http.StatusNotFound)
+		return
+	}
+	writeSaveError(w, r, err)
+}
@@ -0,0 +1,236 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"api/pkg/middleware"
+	"api/pkg/models"
+	"api/pkg/utils"
+)
+
+// Request structure for starting 2FA setup
+type TwoFactorSetupRequest struct {
+	Password string `json:"password"`
+}
+
+// Request structure for confirming 2FA setup or regenerating recovery codes
+type TwoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// Request structure for turning 2FA off
+type TwoFactorDisableRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+// Response structure for 2FA setup: the secret to enter in an authenticator
+// app, or the otpauth:// URI to show as a QR code
+type TwoFactorSetupResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+// Show whether 2FA is enabled for the authenticated user
+func GetTwoFactorStatus(w http.ResponseWriter, r *http.Request) {
+	user, ok := loadCurrentUser(w, r)
+	if !ok {
+		return
+	}
+
+	status := map[string]interface{}{
+		"enabled":    user.TwoFactorEnabled(),
+		"enabled_at": user.TwoFactorEnabledAt,
+		"required":   user.TwoFactorRequired(),
+	}
+	if user.TwoFactorEnabled() {
+		status["recovery_codes_remaining"] = user.RemainingRecoveryCodes()
+	}
+	utils.RespondJSON(w, http.StatusOK, status)
+}
+
+// Start 2FA setup: generate a TOTP secret for the authenticated user
+func SetupTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req TwoFactorSetupRequest
+	utils.ParseBody(r, &req)
+
+	user, ok := loadCurrentUser(w, r)
+	if !ok {
+		return
+	}
+
+	if !checkCurrentPassword(w, user, req.Password) {
+		return
+	}
+
+	secret, uri, err := user.BeginTwoFactorSetup()
+	if err != nil {
+		writeTwoFactorError(w, err)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, TwoFactorSetupResponse{Secret: secret, URI: uri})
+}
+
+// Finish 2FA setup with a code from the authenticator app. The response
+// holds the recovery codes, shown this once, and a new session that counts
+// as signed in with a second factor.
+func EnableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req TwoFactorCodeRequest
+	utils.ParseBody(r, &req)
+
+	if req.Code == "" {
+		http.Error(w, "Code is required", http.StatusBadRequest)
+		return
+	}
+
+	user, ok := loadCurrentUser(w, r)
+	if !ok {
+		return
+	}
+
+	codes, err := user.EnableTwoFactor(req.Code)
+	if err != nil {
+		writeTwoFactorError(w, err)
+		return
+	}
+
+	token, err := utils.GenerateToken(user.ID, user.Email, user.IsAdmin, user.IsEmployee, true)
+	if err != nil {
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+	refreshToken, err := models.CreateRefreshToken(user.ID, true)
+	if err != nil {
+		http.Error(w, "Failed to generate refresh token", http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"recovery_codes": codes,
+		"token":          token,
+		"refresh_token":  refreshToken,
+		"expires_in":     int(utils.AccessTokenTTL.Seconds()),
+	})
+}
+
+// Turn 2FA off. Needs the password and a current code; refused while policy
+// requires 2FA for the user's role.
+func DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req TwoFactorDisableRequest
+	utils.ParseBody(r, &req)
+
+	user, ok := loadCurrentUser(w, r)
+	if !ok {
+		return
+	}
+
+	if user.TwoFactorRequired() {
+		http.Error(w, "Two-factor authentication is required for your account", http.StatusForbidden)
+		return
+	}
+	// The code first: a correct password clears the failure count
+	if !checkTwoFactorCode(w, r, user, req.Code) {
+		return
+	}
+	if !checkCurrentPassword(w, user, req.Password) {
+		return
+	}
+
+	if err := user.DisableTwoFactor(); err != nil {
+		writeTwoFactorError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Replace the recovery codes, e.g. after using some of them
+func RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	var req TwoFactorCodeRequest
+	utils.ParseBody(r, &req)
+
+	user, ok := loadCurrentUser(w, r)
+	if !ok {
+		return
+	}
+
+	if !user.TwoFactorEnabled() {
+		writeTwoFactorError(w, models.ErrTwoFactorNotEnabled)
+		return
+	}
+	if !checkTwoFactorCode(w, r, user, req.Code) {
+		return
+	}
+
+	codes, err := user.RegenerateRecoveryCodes()
+	if err != nil {
+		http.Error(w, "Failed to generate recovery codes", http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"recovery_codes": codes,
+	})
+}
+
+// checkTwoFactorCode verifies a TOTP or recovery code of the authenticated
+// user, throttled like the second step of a login: failures count towards
+// the account lockout and the per-IP login throttle. It writes an error
+// response and returns false when the code is not accepted.
+func checkTwoFactorCode(w http.ResponseWriter, r *http.Request, user *models.User, code string) bool {
+	clientIP := utils.ClientIP(r)
+	if wait := loginThrottle.RetryAfter(clientIP); wait > 0 {
+		writeTooManyAttempts(w, wait, tooManyLoginsMessage)
+		return false
+	}
+	if wait := user.LoginRetryAfter(); wait > 0 {
+		writeTooManyAttempts(w, wait, tooManyLoginsMessage)
+		return false
+	}
+
+	if !user.VerifyTwoFactor(code) {
+		loginThrottle.Fail(clientIP)
+		if err := user.RecordFailedLogin(); err != nil {
+			fmt.Println("failed to record failed login:", err)
+		}
+		writeTwoFactorError(w, models.ErrInvalidTwoFactor)
+		return false
+	}
+
+	loginThrottle.Reset(clientIP)
+	if err := user.ResetFailedLogins(); err != nil {
+		fmt.Println("failed to reset failed logins:", err)
+	}
+	return true
+}
+
+// loadCurrentUser loads the authenticated user's account. It writes an
+// error response and returns false when that fails.
+func loadCurrentUser(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	current, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	user, err := models.GetUserById(current.ID)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return nil, false
+	}
+	return user, true
+}
+
+func writeTwoFactorError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, models.ErrTwoFactorEnabled), errors.Is(err, models.ErrTwoFactorNotEnabled), errors.Is(err, models.ErrTwoFactorNotSetUp):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, models.ErrInvalidTwoFactor):
+		http.Error(w, "Invalid two-factor code", http.StatusBadRequest)
+	default:
+		http.Error(w, "Failed to update two-factor authentication", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,210 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"api/pkg/middleware"
+	"api/pkg/models"
+	"api/pkg/utils"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// Request structure for creating a user as an admin
+type CreateUserRequest struct {
+	Email      string `json:"email"`
+	Password   string `json:"password"`
+	IsAdmin    bool   `json:"is_admin"`
+	IsEmployee bool   `json:"is_employee"`
+}
+
+// Request structure for promoting / demoting a user. Omitted flags keep
+// their current value.
+type UpdateUserRolesRequest struct {
+	IsAdmin    *bool `json:"is_admin"`
+	IsEmployee *bool `json:"is_employee"`
+}
+
+// List users (admin only)
+func GetUsers(w http.ResponseWriter, r *http.Request) {
+	page, pageSize, err := parsePagination(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	search := r.URL.Query().Get("search")
+
+	users, total := models.GetPaginatedUsers(pageSize, (page-1)*pageSize, search)
+
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"users":    users,
+		"total":    total,
+		"page":     page,
+		"pageSize": pageSize,
+		"search":   search,
+	})
+}
+
+// Create a user with any role (admin only)
+func CreateUser(w http.ResponseWriter, r *http.Request) {
+	var req CreateUserRequest
+	utils.ParseBody(r, &req)
+
+	// Validate input
+	if req.Email == "" || req.Password == "" {
+		http.Error(w, "Email and password are required", http.StatusBadRequest)
+		return
+	}
+
+	user := &models.User{
+		Email:      req.Email,
+		IsAdmin:    req.IsAdmin,
+		IsEmployee: req.IsEmployee,
+	}
+
+	// Hash the password
+	if err := user.HashPassword(req.Password); err != nil {
+		http.Error(w, "Failed to hash password", http.StatusInternalServerError)
+		return
+	}
+
+	createdUser, err := models.CreateUser(user)
+	if err != nil {
+		if err == gorm.ErrDuplicatedKey {
+			http.Error(w, "User with this email already exists", http.StatusConflict)
+		} else {
+			http.Error(w, "Failed to create user", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusCreated, createdUser)
+}
+
+// Promote or demote a user (admin only)
+func UpdateUserRoles(w http.ResponseWriter, r *http.Request) {
+	user, ok := loadUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req UpdateUserRolesRequest
+	utils.ParseBody(r, &req)
+
+	isAdmin, isEmployee := user.IsAdmin, user.IsEmployee
+	if req.IsAdmin != nil {
+		isAdmin = *req.IsAdmin
+	}
+	if req.IsEmployee != nil {
+		isEmployee = *req.IsEmployee
+	}
+
+	if err := user.SetRoles(isAdmin, isEmployee); err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, user)
+}
+
+// Disable a user so they can no longer log in (admin only)
+func DisableUser(w http.ResponseWriter, r *http.Request) {
+	setUserDisabled(w, r, true)
+}
+
+// Re-enable a disabled user (admin only)
+func EnableUser(w http.ResponseWriter, r *http.Request) {
+	setUserDisabled(w, r, false)
+}
+
+// Lift a login lockout (admin only)
+func UnlockUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := loadUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := user.Unlock(); err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, user)
+}
+
+func setUserDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	user, ok := loadUser(w, r)
+	if !ok {
+		return
+	}
+
+	// Admins cannot lock themselves out
+	if current, ok := middleware.GetUserFromContext(r.Context()); ok && disabled && current.ID == user.ID {
+		http.Error(w, "You cannot disable your own account", http.StatusBadRequest)
+		return
+	}
+
+	if err := user.SetDisabled(disabled); err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, user)
+}
+
+// loadUser fetches the user named by the UserId route variable, writing a
+// 400 or 404 response when there is none
+func loadUser(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	ID, err := strconv.ParseUint(mux.Vars(r)["UserId"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	user, err := models.GetUserById(uint(ID))
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return user, true
+}
+
+func writeUserError(w http.ResponseWriter, err error) {
+	if errors.Is(err, models.ErrLastAdmin) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	http.Error(w, "Failed to update user", http.StatusInternalServerError)
+}
+
+// Largest pageSize a client may ask for
+const maxPageSize = 100
+
+// parsePagination reads the page and pageSize query parameters, defaulting
+// to the first page of 10
+func parsePagination(r *http.Request) (int, int, error) {
+	page, pageSize := 1, 10
+
+	if pageStr := r.URL.Query().Get("page"); pageStr != "" {
+		value, err := strconv.Atoi(pageStr)
+		if err != nil || value < 1 {
+			return 0, 0, errors.New("Invalid page parameter")
+		}
+		page = value
+	}
+
+	if pageSizeStr := r.URL.Query().Get("pageSize"); pageSizeStr != "" {
+		value, err := strconv.Atoi(pageSizeStr)
+		if err != nil || value < 1 || value > maxPageSize {
+			return 0, 0, fmt.Errorf("pageSize must be between 1 and %d", maxPageSize)
+		}
+		pageSize = value
+	}
+
+	return page, pageSize, nil
+}
@@ -0,0 +1,137 @@
+package finance
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Longest schedule generated, 50 years of monthly payments
+const MaxScheduleMonths = 600
+
+var ErrNotAmortizing = errors.New("the payment does not pay the loan off within 50 years; set a term or balloon date")
+
+// Loan describes the financing to amortize. Payment may be 0 to compute the
+// level payment that pays off Balance over TermMonths. Without a term the
+// schedule runs until Payment has paid the loan off.
+type Loan struct {
+	Balance      float64
+	InterestRate float64 // annual, percent
+	TermMonths   int
+	Payment      float64
+	FirstPayment Date
+	BalloonDate  *Date // the remaining balance is due with this payment
+}
+
+// ScheduleRow is one monthly payment
+type ScheduleRow struct {
+	Number    int     `json:"number"`
+	Date      Date    `json:"date"`
+	Payment   float64 `json:"payment"` // regular payment, including any balloon
+	Principal float64 `json:"principal"`
+	Interest  float64 `json:"interest"`
+	Balloon   float64 `json:"balloon"` // lump sum paying off the balance
+	Balance   float64 `json:"balance"` // remaining after this payment
+}
+
+// Schedule is a month-by-month amortization schedule
+type Schedule struct {
+	MonthlyPayment float64       `json:"monthly_payment"`
+	Payments       int           `json:"payments"`
+	TotalPaid      float64       `json:"total_paid"`
+	TotalInterest  float64       `json:"total_interest"`
+	BalloonPayment float64       `json:"balloon_payment"`
+	PayoffDate     Date          `json:"payoff_date"`
+	Rows           []ScheduleRow `json:"rows"`
+}
+
+// Amortize generates the payment schedule of loan. Amounts are rounded to
+// cents each month, and the last payment absorbs the rounding difference.
+func Amortize(loan Loan) (*Schedule, error) {
+	if loan.Balance <= 0 {
+		return nil, fmt.Errorf("balance must be positive")
+	}
+	if loan.InterestRate < 0 {
+		return nil, fmt.Errorf("interest rate must not be negative")
+	}
+	if loan.TermMonths < 0 || loan.TermMonths > MaxScheduleMonths {
+		return nil, fmt.Errorf("term must be between 1 and %d months", MaxScheduleMonths)
+	}
+
+	payment := Round2(loan.Payment)
+	if payment <= 0 {
+		if loan.TermMonths == 0 {
+			return nil, fmt.Errorf("a term or a monthly payment is required")
+		}
+		payment = Round2(PaymentForMonths(loan.Balance, loan.InterestRate, loan.TermMonths))
+	}
+
+	// Number of the payment the balloon is due with, if any
+	balloonNumber := 0
+	if loan.BalloonDate != nil {
+		balloonNumber = loan.FirstPayment.MonthsUntil(*loan.BalloonDate) + 1
+		if balloonNumber < 1 {
+			return nil, fmt.Errorf("balloon date must not be before the first payment")
+		}
+	}
+
+	lastNumber := MaxScheduleMonths
+	if loan.TermMonths > 0 {
+		lastNumber = loan.TermMonths
+	}
+	if balloonNumber > 0 && balloonNumber < lastNumber {
+		lastNumber = balloonNumber
+	}
+
+	rate := loan.InterestRate / 100 / 12
+	balance := Round2(loan.Balance)
+	schedule := &Schedule{MonthlyPayment: payment, Rows: []ScheduleRow{}}
+
+	for number := 1; number <= lastNumber && balance > 0; number++ {
+		interest := Round2(balance * rate)
+		row := ScheduleRow{
+			Number:   number,
+			Date:     loan.FirstPayment.AddMonths(number - 1),
+			Interest: interest,
+		}
+
+		principal := Round2(payment - interest)
+		if principal >= balance {
+			// Final payment: only what is left
+			principal = balance
+		}
+		balance = Round2(balance - principal)
+
+		// Whatever remains on the balloon date or at the end of the term is
+		// due in one sum. Leftovers from rounding to cents just go into the
+		// last regular payment.
+		if number == lastNumber && balance > 0 {
+			if number != balloonNumber && balance <= payment {
+				principal = Round2(principal + balance)
+			} else {
+				row.Balloon = balance
+			}
+			balance = 0
+		}
+
+		row.Principal = principal
+		row.Payment = Round2(principal + interest + row.Balloon)
+		row.Balance = balance
+
+		schedule.Rows = append(schedule.Rows, row)
+		schedule.TotalPaid += row.Payment
+		schedule.TotalInterest += row.Interest
+		schedule.BalloonPayment += row.Balloon
+		schedule.PayoffDate = row.Date
+	}
+
+	// Without a term or balloon date the payment alone must pay the loan off
+	if loan.TermMonths == 0 && loan.BalloonDate == nil && schedule.BalloonPayment > 0 {
+		return nil, ErrNotAmortizing
+	}
+
+	schedule.Payments = len(schedule.Rows)
+	schedule.TotalPaid = Round2(schedule.TotalPaid)
+	schedule.TotalInterest = Round2(schedule.TotalInterest)
+	schedule.BalloonPayment = Round2(schedule.BalloonPayment)
+	return schedule, nil
+}
@@ -0,0 +1,248 @@
+package finance
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func date(t *testing.T, value string) Date {
+	t.Helper()
+	d, err := ParseDate(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+// checkSchedule verifies what every schedule must satisfy: rows numbered
+// from 1, principal adding up to the balance, totals matching the rows and
+// nothing owed at the end
+func checkSchedule(t *testing.T, s *Schedule, balance float64) {
+	t.Helper()
+
+	var principal, paid, interest, balloon float64
+	for i, row := range s.Rows {
+		if row.Number != i+1 {
+			t.Fatalf("row %d is numbered %d", i, row.Number)
+		}
+		if got := Round2(row.Principal + row.Interest + row.Balloon); got != row.Payment {
+			t.Errorf("row %d: payment %.2f, parts add up to %.2f", row.Number, row.Payment, got)
+		}
+		principal += row.Principal + row.Balloon
+		paid += row.Payment
+		interest += row.Interest
+		balloon += row.Balloon
+	}
+
+	if s.Payments != len(s.Rows) {
+		t.Errorf("payments = %d, rows = %d", s.Payments, len(s.Rows))
+	}
+	if got := Round2(principal); got != balance {
+		t.Errorf("principal repaid = %.2f, want %.2f", got, balance)
+	}
+	if got := Round2(paid); got != s.TotalPaid {
+		t.Errorf("total paid = %.2f, rows add up to %.2f", s.TotalPaid, got)
+	}
+	if got := Round2(interest); got != s.TotalInterest {
+		t.Errorf("total interest = %.2f, rows add up to %.2f", s.TotalInterest, got)
+	}
+	if got := Round2(balloon); got != s.BalloonPayment {
+		t.Errorf("balloon = %.2f, rows add up to %.2f", s.BalloonPayment, got)
+	}
+	if last := s.Rows[len(s.Rows)-1]; last.Balance != 0 || !last.Date.Equal(s.PayoffDate.Time) {
+		t.Errorf("last row %+v, payoff date %s", last, s.PayoffDate)
+	}
+}
+
+func TestAmortizeLevelPayment(t *testing.T) {
+	s, err := Amortize(Loan{
+		Balance:      100000,
+		InterestRate: 6,
+		TermMonths:   360,
+		FirstPayment: date(t, "2025-01-01"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSchedule(t, s, 100000)
+
+	if s.MonthlyPayment != 599.55 {
+		t.Errorf("monthly payment = %.2f, want 599.55", s.MonthlyPayment)
+	}
+	if s.Payments != 360 {
+		t.Errorf("payments = %d, want 360", s.Payments)
+	}
+	if s.BalloonPayment != 0 {
+		t.Errorf("balloon = %.2f, want none", s.BalloonPayment)
+	}
+	if first := s.Rows[0]; first.Interest != 500 || first.Principal != 99.55 || first.Balance != 99900.45 {
+		t.Errorf("first row = %+v", first)
+	}
+	if got := s.PayoffDate.String(); got != "2054-12-01" {
+		t.Errorf("payoff date = %s, want 2054-12-01", got)
+	}
+}
+
+func TestAmortizeZeroRate(t *testing.T) {
+	s, err := Amortize(Loan{Balance: 1000, TermMonths: 3, FirstPayment: date(t, "2025-01-15")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSchedule(t, s, 1000)
+
+	// 333.33 twice, then the last payment takes the leftover cent
+	want := []float64{333.33, 333.33, 333.34}
+	for i, row := range s.Rows {
+		if row.Payment != want[i] || row.Interest != 0 {
+			t.Errorf("row %d = %+v, want payment %.2f", row.Number, row, want[i])
+		}
+	}
+}
+
+func TestAmortizeBalloon(t *testing.T) {
+	balloon := date(t, "2025-12-01")
+	s, err := Amortize(Loan{
+		Balance:      100000,
+		InterestRate: 6,
+		TermMonths:   360,
+		FirstPayment: date(t, "2025-01-01"),
+		BalloonDate:  &balloon,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSchedule(t, s, 100000)
+
+	if s.Payments != 12 {
+		t.Fatalf("payments = %d, want 12", s.Payments)
+	}
+	last := s.Rows[11]
+	if last.Balloon != s.BalloonPayment || s.BalloonPayment < 98000 {
+		t.Errorf("last row %+v, balloon %.2f", last, s.BalloonPayment)
+	}
+	if !last.Date.Equal(balloon.Time) {
+		t.Errorf("balloon paid on %s, want %s", last.Date, balloon)
+	}
+}
+
+func TestAmortizeFixedPayment(t *testing.T) {
+	// Without a term the payment runs until the loan is paid off
+	s, err := Amortize(Loan{Balance: 1000, InterestRate: 12, Payment: 300, FirstPayment: date(t, "2025-01-01")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSchedule(t, s, 1000)
+
+	if s.Payments != 4 || s.BalloonPayment != 0 {
+		t.Errorf("payments = %d, balloon = %.2f, want 4 and none", s.Payments, s.BalloonPayment)
+	}
+	if last := s.Rows[3]; last.Payment >= 300 {
+		t.Errorf("last payment = %.2f, want less than the regular payment", last.Payment)
+	}
+}
+
+func TestAmortizeNotAmortizing(t *testing.T) {
+	// 10 a month does not cover the 50 a month of interest
+	_, err := Amortize(Loan{Balance: 10000, InterestRate: 6, Payment: 10, FirstPayment: date(t, "2025-01-01")})
+	if !errors.Is(err, ErrNotAmortizing) {
+		t.Errorf("err = %v, want ErrNotAmortizing", err)
+	}
+}
+
+func TestAmortizeInvalid(t *testing.T) {
+	first := date(t, "2025-06-01")
+	early := date(t, "2025-05-01")
+
+	tests := map[string]Loan{
+		"no balance":         {InterestRate: 6, TermMonths: 360, FirstPayment: first},
+		"negative rate":      {Balance: 1000, InterestRate: -1, TermMonths: 12, FirstPayment: first},
+		"term too long":      {Balance: 1000, TermMonths: MaxScheduleMonths + 1, FirstPayment: first},
+		"no term or payment": {Balance: 1000, InterestRate: 6, FirstPayment: first},
+		"balloon before 1st": {Balance: 1000, TermMonths: 12, FirstPayment: first, BalloonDate: &early},
+		"negative term":      {Balance: 1000, TermMonths: -1, FirstPayment: first},
+	}
+
+	for name, loan := range tests {
+		if _, err := Amortize(loan); err == nil {
+			t.Errorf("%s: Amortize accepted %+v", name, loan)
+		}
+	}
+}
+
+func TestDateAddMonths(t *testing.T) {
+	tests := []struct {
+		from   string
+		months int
+		want   string
+	}{
+		{"2025-01-15", 1, "2025-02-15"},
+		{"2025-01-31", 1, "2025-02-28"},
+		{"2024-01-31", 1, "2024-02-29"},
+		{"2025-03-31", 1, "2025-04-30"},
+		{"2025-11-30", 3, "2026-02-28"},
+		{"2025-01-31", 12, "2026-01-31"},
+		{"2025-03-15", -3, "2024-12-15"},
+	}
+
+	for _, tt := range tests {
+		if got := date(t, tt.from).AddMonths(tt.months).String(); got != tt.want {
+			t.Errorf("%s + %d months = %s, want %s", tt.from, tt.months, got, tt.want)
+		}
+	}
+}
+
+func TestDateMonthsUntil(t *testing.T) {
+	if got := date(t, "2025-11-30").MonthsUntil(date(t, "2027-02-01")); got != 15 {
+		t.Errorf("MonthsUntil = %d, want 15", got)
+	}
+	if got := date(t, "2025-06-01").MonthsUntil(date(t, "2025-05-31")); got != -1 {
+		t.Errorf("MonthsUntil = %d, want -1", got)
+	}
+}
+
+func TestDateJSON(t *testing.T) {
+	var value struct {
+		Due Date `json:"due"`
+	}
+	if err := json.Unmarshal([]byte(`{"due":"2025-02-28"}`), &value); err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(encoded) != `{"due":"2025-02-28"}` {
+		t.Errorf("round trip = %s", encoded)
+	}
+
+	for _, input := range []string{`{"due":"02/28/2025"}`, `{"due":20250228}`, `{"due":"2025-02-30"}`} {
+		if err := json.Unmarshal([]byte(input), &value); err == nil {
+			t.Errorf("accepted %s", input)
+		}
+	}
+}
+
+func TestDateScan(t *testing.T) {
+	want := "2025-02-28"
+	inputs := []interface{}{
+		time.Date(2025, 2, 28, 13, 45, 0, 0, time.UTC),
+		[]byte(want),
+		want,
+	}
+
+	for _, input := range inputs {
+		var d Date
+		if err := d.Scan(input); err != nil {
+			t.Errorf("Scan(%T): %v", input, err)
+		} else if d.String() != want {
+			t.Errorf("Scan(%T) = %s, want %s", input, d, want)
+		}
+	}
+
+	var d Date
+	if err := d.Scan(42); err == nil {
+		t.Error("Scan accepted an int")
+	}
+}
@@ -0,0 +1,185 @@
+// Package finance holds the deal math shared by the API: loan payments and
+// the underwriting numbers investors use to compare properties.
+package finance
+
+import "fmt"
+
+// Defaults for assumptions a deal does not record
+const (
+	DefaultTermYears         = 30
+	DefaultVacancyPercent    = 5
+	DefaultManagementPercent = 8
+	DefaultDownPercent       = 20
+)
+
+// Inputs of an underwriting analysis. Amounts are in dollars, monthly
+// amounts per month and rates in percent. Nil means unknown.
+type Inputs struct {
+	PurchasePrice      *float64
+	DownPayment        *float64 // cash paid towards the price; the rest is financed
+	InterestRate       *float64 // annual, on the financed amount
+	TermYears          int
+	MonthlyRent        *float64
+	MonthlyEscrow      *float64 // taxes and insurance
+	MonthlyHOA         *float64
+	MonthlyHoldingCost *float64 // the payment on existing financing, used when no rate is known
+	AssignmentFee      *float64
+	ClosingCosts       *float64
+	VacancyPercent     float64
+	ManagementPercent  float64
+}
+
+// Analysis is the result of Analyze. Figures that cannot be computed from
+// the inputs are nil; Warnings says why. Assumptions lists the defaults
+// that stood in for unknown inputs.
+type Analysis struct {
+	PurchasePrice       *float64 `json:"purchase_price"`
+	DownPayment         *float64 `json:"down_payment"`
+	LoanAmount          *float64 `json:"loan_amount"`
+	InterestRate        *float64 `json:"interest_rate"`
+	TermYears           int      `json:"term_years"`
+	VacancyPercent      float64  `json:"vacancy_percent"`
+	ManagementPercent   float64  `json:"management_percent"`
+	CashToClose         *float64 `json:"cash_to_close"`
+	MonthlyRent         *float64 `json:"monthly_rent"`
+	MonthlyPrincipalInt *float64 `json:"monthly_principal_and_interest"`
+	MonthlyPITI         *float64 `json:"monthly_piti"`
+	MonthlyExpenses     *float64 `json:"monthly_expenses"` // PITI, HOA, vacancy and management
+	MonthlyCashFlow     *float64 `json:"monthly_cash_flow"`
+	AnnualNOI           *float64 `json:"annual_noi"` // net operating income, before debt service
+	CashOnCashReturn    *float64 `json:"cash_on_cash_return"`
+	CapRate             *float64 `json:"cap_rate"`
+	DSCR                *float64 `json:"dscr"`
+	BreakEvenRent       *float64 `json:"break_even_rent"`
+	Assumptions         []string `json:"assumptions"`
+	Warnings            []string `json:"warnings"`
+}
+
+// Analyze computes cash to close, the monthly PITI estimate, cash flow,
+// cash-on-cash return, cap rate, DSCR and break-even rent for a deal.
+//
+// The payment comes from the financed amount, rate and term when a rate is
+// known, and otherwise from MonthlyHoldingCost. Percentages in the result
+// (cash-on-cash, cap rate) are in percent; DSCR is a ratio.
+func Analyze(in Inputs) Analysis {
+	a := Analysis{
+		TermYears:         in.TermYears,
+		VacancyPercent:    in.VacancyPercent,
+		ManagementPercent: in.ManagementPercent,
+		Assumptions:       []string{},
+		Warnings:          []string{},
+	}
+	if a.TermYears <= 0 {
+		a.TermYears = DefaultTermYears
+		a.Assumptions = append(a.Assumptions, fmt.Sprintf("term is unknown; %d years assumed", DefaultTermYears))
+	}
+
+	a.PurchasePrice = in.PurchasePrice
+	a.MonthlyRent = in.MonthlyRent
+	a.InterestRate = in.InterestRate
+
+	// Financing
+	var principalInterest *float64
+	if in.PurchasePrice != nil {
+		var down float64
+		if in.DownPayment != nil {
+			down = *in.DownPayment
+		} else {
+			down = *in.PurchasePrice * DefaultDownPercent / 100
+			a.Assumptions = append(a.Assumptions, fmt.Sprintf("down payment is unknown; %d%% of the purchase price assumed", DefaultDownPercent))
+		}
+		if down > *in.PurchasePrice {
+			down = *in.PurchasePrice
+			a.Warnings = append(a.Warnings, "down payment exceeds the purchase price; treated as a cash purchase")
+		}
+		loan := *in.PurchasePrice - down
+		a.DownPayment = round(down)
+		a.LoanAmount = round(loan)
+
+		switch {
+		case loan == 0:
+			principalInterest = round(0)
+		case in.InterestRate != nil:
+			principalInterest = round(MonthlyPayment(loan, *in.InterestRate, a.TermYears))
+		}
+	} else {
+		a.Warnings = append(a.Warnings, "purchase price is unknown")
+	}
+
+	// PITI: principal and interest plus escrowed taxes and insurance
+	escrow := valueOr(in.MonthlyEscrow, 0)
+	switch {
+	case principalInterest != nil:
+		a.MonthlyPrincipalInt = principalInterest
+		a.MonthlyPITI = round(*principalInterest + escrow)
+	case in.MonthlyHoldingCost != nil:
+		a.MonthlyPITI = round(*in.MonthlyHoldingCost)
+		a.Warnings = append(a.Warnings, "interest rate is unknown; the monthly holding cost is used as the payment")
+	default:
+		a.Warnings = append(a.Warnings, "interest rate is unknown; payment figures cannot be computed")
+	}
+
+	// Cash to close
+	if a.DownPayment != nil {
+		a.CashToClose = round(*a.DownPayment + valueOr(in.AssignmentFee, 0) + valueOr(in.ClosingCosts, 0))
+	}
+
+	hoa := valueOr(in.MonthlyHOA, 0)
+	operatingShare := 1 - (in.VacancyPercent+in.ManagementPercent)/100
+
+	if in.MonthlyRent == nil {
+		a.Warnings = append(a.Warnings, "rent is unknown; income figures cannot be computed")
+	} else {
+		rent := *in.MonthlyRent
+		vacancyAndManagement := rent * (in.VacancyPercent + in.ManagementPercent) / 100
+
+		// NOI leaves out debt service, so taxes and insurance count here
+		// only as the escrow part of PITI
+		noi := (rent - vacancyAndManagement - hoa - escrow) * 12
+		a.AnnualNOI = round(noi)
+		if in.PurchasePrice != nil && *in.PurchasePrice > 0 {
+			a.CapRate = round(noi / *in.PurchasePrice * 100)
+		}
+
+		if a.MonthlyPITI != nil {
+			expenses := *a.MonthlyPITI + hoa + vacancyAndManagement
+			cashFlow := rent - expenses
+			a.MonthlyExpenses = round(expenses)
+			a.MonthlyCashFlow = round(cashFlow)
+
+			if a.CashToClose != nil && *a.CashToClose > 0 {
+				a.CashOnCashReturn = round(cashFlow * 12 / *a.CashToClose * 100)
+			}
+
+			debtService := (*a.MonthlyPITI - escrow) * 12
+			if a.MonthlyPrincipalInt != nil {
+				debtService = *a.MonthlyPrincipalInt * 12
+			}
+			if debtService > 0 {
+				a.DSCR = round(noi / debtService)
+			}
+		}
+	}
+
+	if a.MonthlyPITI != nil {
+		if operatingShare > 0 {
+			a.BreakEvenRent = round((*a.MonthlyPITI + hoa) / operatingShare)
+		} else {
+			a.Warnings = append(a.Warnings, fmt.Sprintf("vacancy and management take %g%% of rent; no rent breaks even", in.VacancyPercent+in.ManagementPercent))
+		}
+	}
+
+	return a
+}
+
+func valueOr(value *float64, fallback float64) float64 {
+	if value == nil {
+		return fallback
+	}
+	return *value
+}
+
+func round(value float64) *float64 {
+	rounded := Round2(value)
+	return &rounded
+}
@@ -0,0 +1,179 @@
+package finance
+
+import (
+	"strings"
+	"testing"
+)
+
+func float(value float64) *float64 {
+	return &value
+}
+
+func assertFigure(t *testing.T, name string, got *float64, want float64) {
+	t.Helper()
+	if got == nil {
+		t.Errorf("%s = nil, want %.2f", name, want)
+	} else if *got != want {
+		t.Errorf("%s = %.2f, want %.2f", name, *got, want)
+	}
+}
+
+func assertNil(t *testing.T, name string, got *float64) {
+	t.Helper()
+	if got != nil {
+		t.Errorf("%s = %.2f, want nil", name, *got)
+	}
+}
+
+func containsMessage(messages []string, part string) bool {
+	for _, message := range messages {
+		if strings.Contains(message, part) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestAnalyze(t *testing.T) {
+	a := Analyze(Inputs{
+		PurchasePrice:     float(200000),
+		DownPayment:       float(40000),
+		InterestRate:      float(6),
+		TermYears:         30,
+		MonthlyRent:       float(2000),
+		MonthlyEscrow:     float(300),
+		AssignmentFee:     float(5000),
+		VacancyPercent:    5,
+		ManagementPercent: 8,
+	})
+
+	assertFigure(t, "loan amount", a.LoanAmount, 160000)
+	assertFigure(t, "principal and interest", a.MonthlyPrincipalInt, 959.28)
+	assertFigure(t, "PITI", a.MonthlyPITI, 1259.28)
+	assertFigure(t, "cash to close", a.CashToClose, 45000)
+	assertFigure(t, "expenses", a.MonthlyExpenses, 1519.28) // PITI plus 13% of rent
+	assertFigure(t, "cash flow", a.MonthlyCashFlow, 480.72)
+	assertFigure(t, "NOI", a.AnnualNOI, 17280)
+	assertFigure(t, "cap rate", a.CapRate, 8.64)
+	assertFigure(t, "cash-on-cash", a.CashOnCashReturn, 12.82)
+	assertFigure(t, "DSCR", a.DSCR, 1.5)
+	assertFigure(t, "break-even rent", a.BreakEvenRent, 1447.45)
+
+	if len(a.Assumptions) != 0 || len(a.Warnings) != 0 {
+		t.Errorf("assumptions %v, warnings %v, want none", a.Assumptions, a.Warnings)
+	}
+}
+
+func TestAnalyzeAssumedDownPayment(t *testing.T) {
+	a := Analyze(Inputs{
+		PurchasePrice: float(200000),
+		InterestRate:  float(6),
+		TermYears:     30,
+	})
+
+	assertFigure(t, "down payment", a.DownPayment, 40000)
+	assertFigure(t, "loan amount", a.LoanAmount, 160000)
+	if !containsMessage(a.Assumptions, "down payment is unknown") {
+		t.Errorf("assumptions %v do not mention the down payment", a.Assumptions)
+	}
+}
+
+func TestAnalyzeAssumedTerm(t *testing.T) {
+	a := Analyze(Inputs{PurchasePrice: float(100000), DownPayment: float(0), InterestRate: float(0)})
+
+	if a.TermYears != DefaultTermYears {
+		t.Errorf("term = %d, want %d", a.TermYears, DefaultTermYears)
+	}
+	assertFigure(t, "principal and interest", a.MonthlyPrincipalInt, 277.78) // 100000 / 360
+	if !containsMessage(a.Assumptions, "term is unknown") {
+		t.Errorf("assumptions %v do not mention the term", a.Assumptions)
+	}
+}
+
+func TestAnalyzeCashPurchase(t *testing.T) {
+	a := Analyze(Inputs{
+		PurchasePrice: float(100000),
+		DownPayment:   float(150000),
+		TermYears:     30,
+		MonthlyRent:   float(1000),
+	})
+
+	assertFigure(t, "down payment", a.DownPayment, 100000)
+	assertFigure(t, "loan amount", a.LoanAmount, 0)
+	assertFigure(t, "PITI", a.MonthlyPITI, 0)
+	assertNil(t, "DSCR", a.DSCR) // no debt service
+	if !containsMessage(a.Warnings, "cash purchase") {
+		t.Errorf("warnings %v do not mention the cash purchase", a.Warnings)
+	}
+}
+
+func TestAnalyzeHoldingCost(t *testing.T) {
+	a := Analyze(Inputs{
+		PurchasePrice:      float(100000),
+		DownPayment:        float(10000),
+		TermYears:          30,
+		MonthlyRent:        float(1500),
+		MonthlyEscrow:      float(200),
+		MonthlyHoldingCost: float(900),
+	})
+
+	assertNil(t, "principal and interest", a.MonthlyPrincipalInt)
+	assertFigure(t, "PITI", a.MonthlyPITI, 900)
+	assertFigure(t, "cash flow", a.MonthlyCashFlow, 600)
+	assertFigure(t, "DSCR", a.DSCR, 1.86) // NOI 15600 over 700 a month without escrow
+	if !containsMessage(a.Warnings, "monthly holding cost is used") {
+		t.Errorf("warnings %v do not mention the holding cost", a.Warnings)
+	}
+}
+
+func TestAnalyzeUnknownInputs(t *testing.T) {
+	a := Analyze(Inputs{TermYears: 30})
+
+	assertNil(t, "down payment", a.DownPayment)
+	assertNil(t, "PITI", a.MonthlyPITI)
+	assertNil(t, "NOI", a.AnnualNOI)
+	assertNil(t, "break-even rent", a.BreakEvenRent)
+	for _, part := range []string{"purchase price is unknown", "payment figures cannot be computed", "rent is unknown"} {
+		if !containsMessage(a.Warnings, part) {
+			t.Errorf("warnings %v do not include %q", a.Warnings, part)
+		}
+	}
+	if len(a.Assumptions) != 0 {
+		t.Errorf("assumptions = %v, want none without a price", a.Assumptions)
+	}
+}
+
+func TestAnalyzeNoBreakEven(t *testing.T) {
+	a := Analyze(Inputs{
+		PurchasePrice:     float(100000),
+		DownPayment:       float(100000),
+		TermYears:         30,
+		VacancyPercent:    50,
+		ManagementPercent: 50,
+	})
+
+	assertNil(t, "break-even rent", a.BreakEvenRent)
+	if !containsMessage(a.Warnings, "no rent breaks even") {
+		t.Errorf("warnings %v do not mention the break-even rent", a.Warnings)
+	}
+}
+
+func TestMonthlyPayment(t *testing.T) {
+	tests := []struct {
+		principal, rate float64
+		years           int
+		want            float64
+	}{
+		{160000, 6, 30, 959.28},
+		{200000, 4.5, 15, 1529.99},
+		{120000, 0, 10, 1000},
+		{0, 6, 30, 0},
+		{100000, 6, 0, 0},
+	}
+
+	for _, tt := range tests {
+		if got := Round2(MonthlyPayment(tt.principal, tt.rate, tt.years)); got != tt.want {
+			t.Errorf("MonthlyPayment(%g, %g, %d) = %.2f, want %.2f", tt.principal, tt.rate, tt.years, got, tt.want)
+		}
+	}
+}
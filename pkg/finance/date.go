@@ -0,0 +1,97 @@
+package finance
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// DateLayout is how dates are written in JSON and CSV
+const DateLayout = "2006-01-02"
+
+// Date is a calendar date without a time of day, such as a payment due
+// date. It is stored in a DATE column and written as "2006-01-02".
+type Date struct {
+	time.Time
+}
+
+// NewDate returns the date of t
+func NewDate(t time.Time) Date {
+	return Date{time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)}
+}
+
+// ParseDate parses a "2006-01-02" date
+func ParseDate(value string) (Date, error) {
+	t, err := time.Parse(DateLayout, value)
+	if err != nil {
+		return Date{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", value)
+	}
+	return Date{t}, nil
+}
+
+// AddMonths returns the date n months later. Days past the end of the
+// target month fall back to its last day, so Jan 31 + 1 month is Feb 28/29.
+func (d Date) AddMonths(n int) Date {
+	first := time.Date(d.Year(), d.Month()+time.Month(n), 1, 0, 0, 0, 0, time.UTC)
+	lastDay := first.AddDate(0, 1, -1).Day()
+	day := d.Day()
+	if day > lastDay {
+		day = lastDay
+	}
+	return Date{time.Date(first.Year(), first.Month(), day, 0, 0, 0, 0, time.UTC)}
+}
+
+// MonthsUntil counts whole months from d to other
+func (d Date) MonthsUntil(other Date) int {
+	return (other.Year()-d.Year())*12 + int(other.Month()) - int(d.Month())
+}
+
+func (d Date) String() string {
+	return d.Format(DateLayout)
+}
+
+func (d Date) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Date) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("dates must be strings in YYYY-MM-DD format")
+	}
+	parsed, err := ParseDate(value)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// Value stores the date in a DATE column
+func (d Date) Value() (driver.Value, error) {
+	return d.Time, nil
+}
+
+// Scan reads a DATE column
+func (d *Date) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case time.Time:
+		*d = NewDate(v)
+	case []byte:
+		parsed, err := ParseDate(string(v))
+		if err != nil {
+			return err
+		}
+		*d = parsed
+	case string:
+		parsed, err := ParseDate(v)
+		if err != nil {
+			return err
+		}
+		*d = parsed
+	default:
+		return fmt.Errorf("cannot scan %T into a date", value)
+	}
+	return nil
+}
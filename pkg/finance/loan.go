@@ -0,0 +1,28 @@
+package finance
+
+import "math"
+
+// MonthlyPayment returns the fixed monthly principal and interest payment
+// that pays off principal over termYears at annualRatePercent (e.g. 6.5)
+func MonthlyPayment(principal float64, annualRatePercent float64, termYears int) float64 {
+	return PaymentForMonths(principal, annualRatePercent, termYears*12)
+}
+
+// PaymentForMonths is MonthlyPayment for a term given in months
+func PaymentForMonths(principal float64, annualRatePercent float64, months int) float64 {
+	if principal <= 0 || months <= 0 {
+		return 0
+	}
+
+	rate := annualRatePercent / 100 / 12
+	if rate == 0 {
+		return principal / float64(months)
+	}
+
+	return principal * rate / (1 - math.Pow(1+rate, -float64(months)))
+}
+
+// Round2 rounds to cents
+func Round2(value float64) float64 {
+	return math.Round(value*100) / 100
+}
@@ -0,0 +1,39 @@
+package imaging
+
+import (
+	"net"
+	"testing"
+)
+
+func TestPublicIP(t *testing.T) {
+	tests := map[string]bool{
+		"93.184.216.34":   true,
+		"2606:4700::1111": true,
+		"100.63.255.255":  true,
+		"100.128.0.1":     true,
+
+		"127.0.0.1":         false,
+		"10.1.2.3":          false,
+		"172.16.0.1":        false,
+		"192.168.1.1":       false,
+		"169.254.169.254":   false, // cloud metadata
+		"100.64.0.1":        false, // carrier-grade NAT
+		"100.127.255.254":   false,
+		"0.0.0.0":           false,
+		"0.1.2.3":           false,
+		"198.18.0.1":        false,
+		"255.255.255.255":   false,
+		"224.0.0.1":         false,
+		"::1":               false,
+		"fd00::1":           false,
+		"fe80::1":           false,
+		"::ffff:10.0.0.1":   false, // IPv4-mapped
+		"::ffff:100.64.0.1": false,
+	}
+
+	for address, want := range tests {
+		if got := publicIP(net.ParseIP(address)); got != want {
+			t.Errorf("publicIP(%s) = %v, want %v", address, got, want)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+)
+
+var ErrMalformed = errors.New("malformed image file")
+
+// EXIF tags we look at
+const (
+	tagOrientation = 0x0112
+	tagGPSInfo     = 0x8825
+)
+
+var (
+	exifHeader = []byte("Exif\x00\x00")
+	xmpHeader  = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	pngHeader  = []byte("\x89PNG\r\n\x1a\n")
+)
+
+// StripLocation removes GPS coordinates from the metadata of a JPEG, PNG
+// or WebP file: the GPS fields of its EXIF block are zeroed and XMP packets
+// mentioning GPS are dropped. Everything else, including the orientation,
+// is kept. Other formats are returned unchanged.
+func StripLocation(contentType string, data []byte) ([]byte, error) {
+	switch contentType {
+	case "image/jpeg":
+		return stripJPEG(data)
+	case "image/png":
+		return stripPNG(data)
+	case "image/webp":
+		return stripWebP(data)
+	}
+	return data, nil
+}
+
+// Orientation returns the EXIF orientation of a JPEG file, 1 (upright)
+// when it has none
+func Orientation(data []byte) int {
+	orientation := 1
+	walkJPEG(data, func(marker byte, segment []byte) bool {
+		if marker == 0xE1 && bytes.HasPrefix(segment, exifHeader) {
+			if value, ok := exifOrientation(segment[len(exifHeader):]); ok {
+				orientation = value
+			}
+			return false
+		}
+		return true
+	})
+	return orientation
+}
+
+// walkJPEG calls visit with the marker and payload of every segment before
+// the image data, until visit returns false. It returns the offset where
+// the image data starts.
+func walkJPEG(data []byte, visit func(marker byte, segment []byte) bool) (int, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 0, ErrMalformed
+	}
+
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			return 0, ErrMalformed
+		}
+		marker := data[pos+1]
+		switch {
+		case marker == 0xFF: // fill byte
+			pos++
+			continue
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7): // no payload
+			pos += 2
+			continue
+		case marker == 0xDA || marker == 0xD9: // start of scan, end of image
+			return pos, nil
+		}
+
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 || pos+2+length > len(data) {
+			return 0, ErrMalformed
+		}
+		if !visit(marker, data[pos+4:pos+2+length]) {
+			return pos, nil
+		}
+		pos += 2 + length
+	}
+	return 0, ErrMalformed
+}
+
+func stripJPEG(data []byte) ([]byte, error) {
+	out := make([]byte, 0, len(data))
+	out = append(out, 0xFF, 0xD8)
+
+	scan, err := walkJPEG(data, func(marker byte, segment []byte) bool {
+		if marker == 0xE1 && bytes.HasPrefix(segment, xmpHeader) && bytes.Contains(segment, []byte("GPS")) {
+			return true
+		}
+
+		start := len(out)
+		out = append(out, 0xFF, marker)
+		out = binary.BigEndian.AppendUint16(out, uint16(len(segment)+2))
+		out = append(out, segment...)
+		if marker == 0xE1 && bytes.HasPrefix(segment, exifHeader) {
+			wipeGPS(out[start+4+len(exifHeader):])
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append(out, data[scan:]...), nil
+}
+
+func stripPNG(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngHeader) {
+		return nil, ErrMalformed
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, pngHeader...)
+	for pos := len(pngHeader); pos < len(data); {
+		if pos+12 > len(data) {
+			return nil, ErrMalformed
+		}
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		if length < 0 || pos+12+length > len(data) {
+			return nil, ErrMalformed
+		}
+		chunkType := string(data[pos+4 : pos+8])
+		chunkData := data[pos+8 : pos+8+length]
+		chunk := data[pos : pos+12+length]
+		pos += 12 + length
+
+		switch {
+		case chunkType == "iTXt" && bytes.HasPrefix(chunkData, []byte("XML:com.adobe.xmp\x00")) && bytes.Contains(chunkData, []byte("GPS")):
+			continue
+		case chunkType == "eXIf":
+			start := len(out)
+			out = append(out, chunk...)
+			wipeGPS(out[start+8 : start+8+length])
+			binary.BigEndian.PutUint32(out[start+8+length:], crc32.ChecksumIEEE(out[start+4:start+8+length]))
+		default:
+			out = append(out, chunk...)
+		}
+	}
+	return out, nil
+}
+
+// VP8X flag announcing an XMP chunk
+const webpFlagXMP = 0x04
+
+func stripWebP(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, ErrMalformed
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:12]...)
+	droppedXMP := false
+	vp8x := -1
+	for pos := 12; pos < len(data); {
+		if pos+8 > len(data) {
+			return nil, ErrMalformed
+		}
+		chunkType := string(data[pos : pos+4])
+		length := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		padded := length + length%2
+		if length < 0 || pos+8+padded > len(data) {
+			return nil, ErrMalformed
+		}
+		chunk := data[pos : pos+8+padded]
+		pos += 8 + padded
+
+		switch chunkType {
+		case "XMP ":
+			if bytes.Contains(chunk, []byte("GPS")) {
+				droppedXMP = true
+				continue
+			}
+			out = append(out, chunk...)
+		case "EXIF":
+			start := len(out)
+			out = append(out, chunk...)
+			exif := out[start+8 : start+8+length]
+			wipeGPS(bytes.TrimPrefix(exif, exifHeader))
+		case "VP8X":
+			vp8x = len(out)
+			out = append(out, chunk...)
+		default:
+			out = append(out, chunk...)
+		}
+	}
+
+	if droppedXMP && vp8x >= 0 {
+		out[vp8x+8] &^= webpFlagXMP
+	}
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+	return out, nil
+}
+
+// tiffOrder reads the byte order of a TIFF structure, the body of an EXIF
+// block
+func tiffOrder(tiff []byte) (binary.ByteOrder, bool) {
+	if len(tiff) < 8 {
+		return nil, false
+	}
+	switch string(tiff[:2]) {
+	case "II":
+		return binary.LittleEndian, true
+	case "MM":
+		return binary.BigEndian, true
+	}
+	return nil, false
+}
+
+// ifdEntries returns the 12 byte entries of the IFD at offset
+func ifdEntries(tiff []byte, order binary.ByteOrder, offset uint32) ([][]byte, bool) {
+	if uint64(offset)+2 > uint64(len(tiff)) {
+		return nil, false
+	}
+	count := int(order.Uint16(tiff[offset:]))
+	start := int(offset) + 2
+	if start+count*12 > len(tiff) {
+		return nil, false
+	}
+
+	entries := make([][]byte, count)
+	for i := range entries {
+		entries[i] = tiff[start+i*12 : start+(i+1)*12]
+	}
+	return entries, true
+}
+
+func exifOrientation(tiff []byte) (int, bool) {
+	order, ok := tiffOrder(tiff)
+	if !ok {
+		return 0, false
+	}
+	entries, ok := ifdEntries(tiff, order, order.Uint32(tiff[4:]))
+	if !ok {
+		return 0, false
+	}
+	for _, entry := range entries {
+		if order.Uint16(entry) == tagOrientation {
+			return int(order.Uint16(entry[8:])), true
+		}
+	}
+	return 0, false
+}
+
+// Bytes per value of each TIFF field type
+var tiffTypeSizes = map[uint16]uint64{
+	1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8,
+}
+
+// wipeGPS zeroes the GPS IFD of a TIFF structure in place, its entries and
+// the values they point to, leaving an empty IFD so offsets stay valid
+func wipeGPS(tiff []byte) {
+	order, ok := tiffOrder(tiff)
+	if !ok {
+		return
+	}
+	entries, ok := ifdEntries(tiff, order, order.Uint32(tiff[4:]))
+	if !ok {
+		return
+	}
+
+	for _, entry := range entries {
+		if order.Uint16(entry) != tagGPSInfo {
+			continue
+		}
+		offset := order.Uint32(entry[8:])
+		gps, ok := ifdEntries(tiff, order, offset)
+		if !ok {
+			return
+		}
+
+		for _, field := range gps {
+			size := tiffTypeSizes[order.Uint16(field[2:])] * uint64(order.Uint32(field[4:]))
+			if size <= 4 {
+				continue
+			}
+			valueOffset := uint64(order.Uint32(field[8:]))
+			if valueOffset+size <= uint64(len(tiff)) {
+				clear(tiff[valueOffset : valueOffset+size])
+			}
+		}
+
+		// Zero the entry count, the entries and the next IFD offset
+		end := uint64(offset) + 2 + uint64(len(gps))*12 + 4
+		if end > uint64(len(tiff)) {
+			end = uint64(len(tiff))
+		}
+		clear(tiff[offset:end])
+		return
+	}
+}
@@ -0,0 +1,101 @@
+package imaging
+
+import (
+	"image"
+	"image/draw"
+	"math"
+)
+
+// toRGBA converts img to premultiplied RGBA, the form averaging works on
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Rect.Min == (image.Point{}) {
+		return rgba
+	}
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Rect, img, bounds.Min, draw.Src)
+	return rgba
+}
+
+// contribution is a source pixel and its share of a destination pixel
+type contribution struct {
+	index  int
+	weight float64
+}
+
+// areaWeights maps each of dst pixels to the source pixels it covers when
+// src pixels are squeezed into dst, weighted by overlap. This is a box
+// filter, which is what downscaling photos needs to avoid aliasing.
+func areaWeights(src, dst int) [][]contribution {
+	scale := float64(src) / float64(dst)
+	weights := make([][]contribution, dst)
+	for i := range weights {
+		start, end := float64(i)*scale, float64(i+1)*scale
+		for j := int(math.Floor(start)); j < src && float64(j) < end; j++ {
+			overlap := math.Min(end, float64(j+1)) - math.Max(start, float64(j))
+			if overlap > 0 {
+				weights[i] = append(weights[i], contribution{j, overlap / scale})
+			}
+		}
+	}
+	return weights
+}
+
+// Resize scales img to width x height by area averaging. It is meant for
+// shrinking; enlarging works but only repeats pixels.
+func Resize(img image.Image, width, height int) *image.RGBA {
+	src := toRGBA(img)
+	srcWidth, srcHeight := src.Rect.Dx(), src.Rect.Dy()
+	if width == srcWidth && height == srcHeight {
+		return src
+	}
+
+	// Horizontal pass into a float buffer of width x srcHeight
+	columns := areaWeights(srcWidth, width)
+	tmp := make([]float64, width*srcHeight*4)
+	for y := 0; y < srcHeight; y++ {
+		row := src.Pix[y*src.Stride:]
+		for x, contributions := range columns {
+			var r, g, b, a float64
+			for _, c := range contributions {
+				p := row[c.index*4:]
+				r += float64(p[0]) * c.weight
+				g += float64(p[1]) * c.weight
+				b += float64(p[2]) * c.weight
+				a += float64(p[3]) * c.weight
+			}
+			t := tmp[(y*width+x)*4:]
+			t[0], t[1], t[2], t[3] = r, g, b, a
+		}
+	}
+
+	// Vertical pass into the result
+	rows := areaWeights(srcHeight, height)
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y, contributions := range rows {
+		for x := 0; x < width; x++ {
+			var r, g, b, a float64
+			for _, c := range contributions {
+				t := tmp[(c.index*width+x)*4:]
+				r += t[0] * c.weight
+				g += t[1] * c.weight
+				b += t[2] * c.weight
+				a += t[3] * c.weight
+			}
+			d := dst.Pix[y*dst.Stride+x*4:]
+			d[0], d[1], d[2], d[3] = clamp(r), clamp(g), clamp(b), clamp(a)
+		}
+	}
+	return dst
+}
+
+func clamp(v float64) uint8 {
+	v = math.Round(v)
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return uint8(v)
+}
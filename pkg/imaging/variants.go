@@ -0,0 +1,119 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"math"
+)
+
+var (
+	ErrUnsupported = errors.New("only JPEG and PNG images can be resized")
+	ErrTooLarge    = errors.New("image has too many pixels")
+)
+
+// Largest image decoded, in pixels, to bound memory use
+const MaxPixels = 40_000_000
+
+// Size is a variant width
+type Size struct {
+	Name  string
+	Width int
+}
+
+// Sizes of the responsive variants generated for every photo
+var Sizes = []Size{
+	{"thumbnail", 320},
+	{"medium", 800},
+	{"large", 1600},
+}
+
+// Variant is a resized copy of an image, encoded and ready to store
+type Variant struct {
+	Name        string
+	Width       int
+	Height      int
+	ContentType string
+	Extension   string
+	Data        []byte
+}
+
+// Result is the upright size of an image and its variants
+type Result struct {
+	Width    int
+	Height   int
+	Variants []Variant
+}
+
+// Variants decodes a JPEG or PNG image and returns a copy scaled to each
+// of Sizes that is smaller than the image, turned upright according to its
+// EXIF orientation. Variants carry no metadata. Opaque images are encoded
+// as JPEG, images with transparency as PNG.
+func Variants(contentType string, data []byte) (*Result, error) {
+	if contentType != "image/jpeg" && contentType != "image/png" {
+		return nil, ErrUnsupported
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return nil, ErrMalformed
+	}
+	if config.Width*config.Height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	src := toRGBA(decoded)
+
+	orientation := 1
+	if contentType == "image/jpeg" {
+		orientation = Orientation(data)
+	}
+
+	width, height := src.Rect.Dx(), src.Rect.Dy()
+	if swapsAxes(orientation) {
+		width, height = height, width
+	}
+	result := &Result{Width: width, Height: height}
+
+	for _, size := range Sizes {
+		if size.Width >= width {
+			continue
+		}
+		variantWidth := size.Width
+		variantHeight := int(math.Max(1, math.Round(float64(height)*float64(variantWidth)/float64(width))))
+
+		var resized *image.RGBA
+		if swapsAxes(orientation) {
+			resized = Resize(src, variantHeight, variantWidth)
+		} else {
+			resized = Resize(src, variantWidth, variantHeight)
+		}
+		resized = Orient(resized, orientation)
+
+		variant := Variant{Name: size.Name, Width: variantWidth, Height: variantHeight}
+		var buf bytes.Buffer
+		if resized.Opaque() {
+			variant.ContentType, variant.Extension = "image/jpeg", ".jpg"
+			err = jpeg.Encode(&buf, resized, &jpeg.Options{Quality: 82})
+		} else {
+			variant.ContentType, variant.Extension = "image/png", ".png"
+			err = png.Encode(&buf, resized)
+		}
+		if err != nil {
+			return nil, err
+		}
+		variant.Data = buf.Bytes()
+		result.Variants = append(result.Variants, variant)
+	}
+	return result, nil
+}
@@ -0,0 +1,17 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// LogSender prints messages instead of delivering them, so that links in
+// the emails can be followed in development. It keeps nothing, and must not
+// be used in production: the bodies include password reset links.
+type LogSender struct{}
+
+func (LogSender) Send(ctx context.Context, msg Message) error {
+	fmt.Printf("[mail] to=%s subject=%q\n%s\n", strings.Join(msg.To, ","), msg.Subject, msg.Body)
+	return nil
+}
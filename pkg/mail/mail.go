@@ -0,0 +1,79 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+)
+
+var ErrNotConfigured = errors.New("email is not configured: SMTP_HOST is not set")
+
+// Message is a plain text email
+type Message struct {
+	To      []string
+	ReplyTo string // optional, e.g. the buyer who sent an inquiry
+	Subject string
+	Body    string
+}
+
+// Sender delivers email. SMTPSender is used in production, LogSender in
+// development and MemorySender in tests.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+var (
+	defaultSender   Sender
+	defaultSenderMu sync.Mutex
+)
+
+// CheckConfig fails unless email can be delivered: SMTP_HOST must be set,
+// except with APP_ENV=development where emails are logged instead. main
+// refuses to start otherwise.
+func CheckConfig() error {
+	if os.Getenv("SMTP_HOST") == "" && !development() {
+		return errors.New("SMTP_HOST is not set; set it, or APP_ENV=development to log emails instead")
+	}
+	return nil
+}
+
+// DefaultSender returns the sender configured through the environment:
+// SMTP when SMTP_HOST is set, otherwise a LogSender with
+// APP_ENV=development. Without either every send fails with
+// ErrNotConfigured.
+func DefaultSender() Sender {
+	defaultSenderMu.Lock()
+	defer defaultSenderMu.Unlock()
+
+	if defaultSender == nil {
+		switch {
+		case os.Getenv("SMTP_HOST") != "":
+			defaultSender = NewSMTPSenderFromEnv()
+		case development():
+			defaultSender = LogSender{}
+		default:
+			defaultSender = unconfiguredSender{}
+		}
+	}
+
+	return defaultSender
+}
+
+func development() bool {
+	return os.Getenv("APP_ENV") == "development"
+}
+
+type unconfiguredSender struct{}
+
+func (unconfiguredSender) Send(ctx context.Context, msg Message) error {
+	return ErrNotConfigured
+}
+
+// SetDefaultSender replaces the sender returned by DefaultSender, e.g. with
+// a MemorySender in tests
+func SetDefaultSender(sender Sender) {
+	defaultSenderMu.Lock()
+	defer defaultSenderMu.Unlock()
+	defaultSender = sender
+}
@@ -0,0 +1,47 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestCheckConfig(t *testing.T) {
+	tests := []struct {
+		smtpHost, appEnv string
+		wantErr          bool
+	}{
+		{"smtp.example.com", "", false},
+		{"smtp.example.com", "development", false},
+		{"", "development", false},
+		{"", "", true},
+		{"", "production", true},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("SMTP_HOST", tt.smtpHost)
+		t.Setenv("APP_ENV", tt.appEnv)
+		if err := CheckConfig(); (err != nil) != tt.wantErr {
+			t.Errorf("SMTP_HOST=%q APP_ENV=%q: CheckConfig() = %v", tt.smtpHost, tt.appEnv, err)
+		}
+	}
+}
+
+func TestDefaultSenderWithoutSMTP(t *testing.T) {
+	previous := defaultSender
+	defer SetDefaultSender(previous)
+
+	t.Setenv("SMTP_HOST", "")
+	t.Setenv("APP_ENV", "")
+	SetDefaultSender(nil)
+	err := DefaultSender().Send(context.Background(), Message{To: []string{"jane@example.com"}, Subject: "Reset your password"})
+	if !errors.Is(err, ErrNotConfigured) {
+		t.Errorf("Send without SMTP = %v, want ErrNotConfigured", err)
+	}
+
+	t.Setenv("APP_ENV", "development")
+	SetDefaultSender(nil)
+	if _, ok := DefaultSender().(LogSender); !ok {
+		t.Errorf("DefaultSender in development = %T, want LogSender", DefaultSender())
+	}
+}
@@ -1,10 +1,13 @@
 package middleware
 
 import (
+	"api/pkg/models"
 	"api/pkg/utils"
 	"context"
+	"errors"
 	"net/http"
 	"strings"
+	"time"
 )
 
 // Key for user context
@@ -17,48 +20,135 @@ type UserContext struct {
 	ID         uint
 	Email      string
 	IsAdmin    bool
-	IsEmployee bool // Add this line
+	IsEmployee bool
+	TwoFactor  bool // signed in with a second factor
+
+	// Set when the request is authenticated with an API key instead of a
+	// user login; the key's scopes replace the role's permissions
+	APIKeyID uint
+	Scopes   []Permission
 }
 
-// AuthMiddleware checks for a valid JWT token
+// Header carrying an API key
+const APIKeyHeader = "X-API-Key"
+
+// IsAPIKey reports whether the request was authenticated with an API key
+func (u *UserContext) IsAPIKey() bool {
+	return u.APIKeyID != 0
+}
+
+// AuthMiddleware checks for a valid JWT token or API key
 func AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Get the Authorization header
 		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
+		apiKey := r.Header.Get(APIKeyHeader)
+		if authHeader == "" && apiKey == "" {
 			http.Error(w, "Authorization header is required", http.StatusUnauthorized)
 			return
 		}
 
-		// Check if it's a Bearer token
-		if !strings.HasPrefix(authHeader, "Bearer ") {
-			http.Error(w, "Invalid authorization format", http.StatusUnauthorized)
+		user, err := authenticate(authHeader, apiKey)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
 
-		// Extract the token
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+		// Call the next handler with the user info in the context
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), UserContextKey, *user)))
+	})
+}
+
+// OptionalAuthMiddleware adds the user to the context when the request
+// carries a token, and lets anonymous requests through. A token that is
+// present but invalid is still rejected.
+func OptionalAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authHeader := r.Header.Get("Authorization")
+		apiKey := r.Header.Get(APIKeyHeader)
+		if authHeader == "" && apiKey == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
 
-		// Validate the token
-		claims, err := utils.ValidateToken(tokenString)
+		user, err := authenticate(authHeader, apiKey)
 		if err != nil {
-			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
 
-		// Add user info to context
-		ctx := context.WithValue(r.Context(), UserContextKey, UserContext{
-			ID:         claims.UserID,
-			Email:      claims.Email,
-			IsAdmin:    claims.IsAdmin,
-			IsEmployee: claims.IsEmployee, // Add this line
-		})
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), UserContextKey, *user)))
+	})
+}
 
-		// Call the next handler with the updated context
-		next.ServeHTTP(w, r.WithContext(ctx))
+// RejectAPIKeys only lets through requests made by a signed-in user, for
+// routes about the user's own account. It must run after AuthMiddleware.
+func RejectAPIKeys(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, ok := GetUserFromContext(r.Context()); ok && user.IsAPIKey() {
+			http.Error(w, "This endpoint requires a user login", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
 	})
 }
 
+// authenticate validates the API key or the Authorization header and
+// returns the user it identifies
+func authenticate(authHeader string, apiKey string) (*UserContext, error) {
+	if apiKey != "" {
+		return authenticateAPIKey(apiKey)
+	}
+
+	// Check if it's a Bearer token
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		return nil, errors.New("Invalid authorization format")
+	}
+
+	// Extract the token
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+
+	// Validate the token
+	claims, err := utils.ValidateToken(tokenString)
+	if err != nil {
+		return nil, errors.New("Invalid or expired token")
+	}
+
+	// Reject tokens revoked by logout or by signing the user out everywhere
+	var issuedAt time.Time
+	if claims.IssuedAt != nil {
+		issuedAt = claims.IssuedAt.Time
+	}
+	if models.IsAccessTokenRevoked(claims.ID, claims.UserID, issuedAt) {
+		return nil, errors.New("Token has been revoked")
+	}
+
+	return &UserContext{
+		ID:         claims.UserID,
+		Email:      claims.Email,
+		IsAdmin:    claims.IsAdmin,
+		IsEmployee: claims.IsEmployee,
+		TwoFactor:  claims.TwoFactor,
+	}, nil
+}
+
+func authenticateAPIKey(plain string) (*UserContext, error) {
+	key, err := models.AuthenticateAPIKey(plain)
+	if err != nil {
+		return nil, errors.New("Invalid or expired API key")
+	}
+
+	scopes := make([]Permission, len(key.Scopes))
+	for i, scope := range key.Scopes {
+		scopes[i] = Permission(scope)
+	}
+
+	return &UserContext{
+		APIKeyID: key.ID,
+		Scopes:   scopes,
+	}, nil
+}
+
 // GetUserFromContext extracts user info from context
 func GetUserFromContext(ctx context.Context) (*UserContext, bool) {
 	user, ok := ctx.Value(UserContextKey).(UserContext)
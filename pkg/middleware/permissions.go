@@ -0,0 +1,196 @@
+package middleware
+
+import (
+	"net/http"
+
+	"api/pkg/config"
+)
+
+// Role of an authenticated user, derived from the IsAdmin / IsEmployee flags
+type Role string
+
+const (
+	RoleAdmin    Role = "admin"
+	RoleEmployee Role = "employee"
+	RoleUser     Role = "user"
+)
+
+// Permission is a single action a role may perform
+type Permission string
+
+const (
+	PermissionCreateProperty Permission = "properties:create"
+	PermissionUpdateProperty Permission = "properties:update"
+	PermissionDeleteProperty Permission = "properties:delete"
+	PermissionManageUsers    Permission = "users:manage"
+	PermissionManageAPIKeys  Permission = "api_keys:manage"
+	PermissionManageLeads    Permission = "leads:manage"
+
+	// Restricted to properties the user submitted
+	PermissionUpdateOwnProperty Permission = "properties:update:own"
+	PermissionDeleteOwnProperty Permission = "properties:delete:own"
+)
+
+// rolePermissions is the role → permission matrix. Admins can do anything
+// employees can, plus manage accounts; employees edit deals and work the
+// leads inbox; regular users can submit deals and edit the ones they
+// submitted.
+var rolePermissions = map[Role][]Permission{
+	RoleAdmin: {
+		PermissionCreateProperty,
+		PermissionUpdateProperty,
+		PermissionDeleteProperty,
+		PermissionManageUsers,
+		PermissionManageAPIKeys,
+		PermissionManageLeads,
+	},
+	RoleEmployee: {
+		PermissionCreateProperty,
+		PermissionUpdateProperty,
+		PermissionDeleteProperty,
+		PermissionManageLeads,
+	},
+	RoleUser: {
+		PermissionCreateProperty,
+		PermissionUpdateOwnProperty,
+		PermissionDeleteOwnProperty,
+	},
+}
+
+// APIKeyScopes are the permissions an API key may be granted. Account
+// management stays with signed-in admins.
+var APIKeyScopes = []Permission{
+	PermissionCreateProperty,
+	PermissionUpdateProperty,
+	PermissionDeleteProperty,
+}
+
+// IsAPIKeyScope reports whether scope can be granted to an API key
+func IsAPIKeyScope(scope string) bool {
+	for _, allowed := range APIKeyScopes {
+		if string(allowed) == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Role returns the user's highest role. Staff who did not sign in with a
+// second factor act as regular users while REQUIRE_STAFF_2FA is set.
+func (u *UserContext) Role() Role {
+	if u.NeedsTwoFactor() {
+		return RoleUser
+	}
+
+	switch {
+	case u.IsAdmin:
+		return RoleAdmin
+	case u.IsEmployee:
+		return RoleEmployee
+	default:
+		return RoleUser
+	}
+}
+
+// NeedsTwoFactor reports whether the user holds a staff role that policy
+// only grants after signing in with a second factor, and has not done so
+func (u *UserContext) NeedsTwoFactor() bool {
+	return (u.IsAdmin || u.IsEmployee) && !u.TwoFactor && config.RequireStaffTwoFactor()
+}
+
+// Can reports whether the user's role, or the API key's scopes, grant
+// permission
+func (u *UserContext) Can(permission Permission) bool {
+	permissions := rolePermissions[u.Role()]
+	if u.IsAPIKey() {
+		permissions = u.Scopes
+	}
+
+	for _, granted := range permissions {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// RequirePermission only lets through users whose role grants every one of
+// the given permissions. It must run after AuthMiddleware.
+func RequirePermission(permissions ...Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := GetUserFromContext(r.Context())
+			if !ok {
+				http.Error(w, "Authentication required", http.StatusUnauthorized)
+				return
+			}
+
+			for _, permission := range permissions {
+				if !user.Can(permission) {
+					forbidden(w, user)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireAnyPermission only lets through users whose role grants at least
+// one of the given permissions. Handlers behind it decide which one applies,
+// e.g. editing any property versus editing one's own. It must run after
+// AuthMiddleware.
+func RequireAnyPermission(permissions ...Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := GetUserFromContext(r.Context())
+			if !ok {
+				http.Error(w, "Authentication required", http.StatusUnauthorized)
+				return
+			}
+
+			for _, permission := range permissions {
+				if user.Can(permission) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			forbidden(w, user)
+		})
+	}
+}
+
+// RequireRole only lets through users holding one of the given roles. It
+// must run after AuthMiddleware.
+func RequireRole(roles ...Role) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := GetUserFromContext(r.Context())
+			if !ok {
+				http.Error(w, "Authentication required", http.StatusUnauthorized)
+				return
+			}
+
+			role := user.Role()
+			for _, allowed := range roles {
+				if role == allowed {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			forbidden(w, user)
+		})
+	}
+}
+
+// forbidden answers 403, pointing staff at 2FA when that is what is missing
+func forbidden(w http.ResponseWriter, user *UserContext) {
+	if user.NeedsTwoFactor() {
+		http.Error(w, "Two-factor authentication is required for this action", http.StatusForbidden)
+		return
+	}
+	http.Error(w, "You do not have permission to perform this action", http.StatusForbidden)
+}
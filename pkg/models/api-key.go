@@ -0,0 +1,126 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"api/pkg/config"
+	"api/pkg/utils"
+
+	"gorm.io/gorm"
+)
+
+// Plain API keys look like mcf_<43 random characters>; the first
+// apiKeyPrefixLength characters are stored in clear to tell keys apart
+const (
+	apiKeyPrefix       = "mcf_"
+	apiKeyPrefixLength = 12
+)
+
+var (
+	ErrInvalidAPIKey = errors.New("invalid, expired or revoked API key")
+)
+
+// APIKey gives a partner site or script access to the API without a user
+// login. Only a hash of the key is stored; the plain key is shown once when
+// it is created. Scopes are the permissions the key grants.
+type APIKey struct {
+	gorm.Model
+	Name            string     `json:"name" gorm:"type:varchar(255);not null"`
+	Prefix          string     `json:"prefix" gorm:"type:varchar(16);index;not null"`
+	KeyHash         string     `json:"-" gorm:"type:char(64);uniqueIndex;not null"`
+	Scopes          []string   `json:"scopes" gorm:"serializer:json"`
+	ExpiresAt       *time.Time `json:"expires_at"`
+	LastUsedAt      *time.Time `json:"last_used_at"`
+	UsageCount      int64      `json:"usage_count" gorm:"not null;default:0"`
+	RevokedAt       *time.Time `json:"revoked_at"`
+	CreatedByUserID *uint      `json:"created_by_user_id" gorm:"index"`
+	CreatedByUser   *User      `json:"-" gorm:"foreignKey:CreatedByUserID;constraint:OnDelete:SET NULL"`
+}
+
+func init() {
+	db = config.GetDB()
+	db.AutoMigrate(&APIKey{})
+}
+
+// CreateAPIKey stores a new key and returns it with the plain key to hand
+// to its holder
+func CreateAPIKey(name string, scopes []string, expiresAt *time.Time, createdByUserID *uint) (*APIKey, string, error) {
+	random, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+	plain := apiKeyPrefix + random
+
+	key := &APIKey{
+		Name:            name,
+		Prefix:          plain[:apiKeyPrefixLength],
+		KeyHash:         utils.HashToken(plain),
+		Scopes:          scopes,
+		ExpiresAt:       expiresAt,
+		CreatedByUserID: createdByUserID,
+	}
+	if err := db.Create(key).Error; err != nil {
+		return nil, "", err
+	}
+	return key, plain, nil
+}
+
+// AuthenticateAPIKey looks up an active key by its plain value and records
+// the use
+func AuthenticateAPIKey(plain string) (*APIKey, error) {
+	var key APIKey
+	if err := db.Where("key_hash = ?", utils.HashToken(plain)).First(&key).Error; err != nil {
+		return nil, ErrInvalidAPIKey
+	}
+	if !key.IsActive() {
+		return nil, ErrInvalidAPIKey
+	}
+
+	now := time.Now()
+	db.Model(&APIKey{}).Where("id = ?", key.ID).Updates(map[string]interface{}{
+		"usage_count":  gorm.Expr("usage_count + 1"),
+		"last_used_at": now,
+	})
+	key.UsageCount++
+	key.LastUsedAt = &now
+
+	return &key, nil
+}
+
+// IsActive reports whether the key is neither revoked nor expired
+func (k *APIKey) IsActive() bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	return k.ExpiresAt == nil || k.ExpiresAt.After(time.Now())
+}
+
+// Revoke stops the key from working. The row is kept for its usage history.
+func (k *APIKey) Revoke() error {
+	if k.RevokedAt != nil {
+		return nil
+	}
+	now := time.Now()
+	k.RevokedAt = &now
+	return db.Model(k).Select("revoked_at").Updates(k).Error
+}
+
+func GetAPIKeyById(ID uint) (*APIKey, error) {
+	var key APIKey
+	if err := db.First(&key, ID).Error; err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// GetPaginatedAPIKeys lists keys, newest first
+func GetPaginatedAPIKeys(limit int, offset int) ([]APIKey, int64) {
+	var keys []APIKey
+	var total int64
+
+	db.Model(&APIKey{}).Count(&total)
+	db.Order("created_at DESC, id DESC").Limit(limit).Offset(offset).Find(&keys)
+
+	return keys, total
+}
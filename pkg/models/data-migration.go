@@ -0,0 +1,38 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// DataMigration records a one-off data conversion that has been applied,
+// so it runs once per database
+type DataMigration struct {
+	Name      string    `gorm:"primaryKey;type:varchar(128)"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+// runDataMigration runs migrate unless the migration called name has
+// already been applied. A failed migration is reported and retried on the
+// next start.
+func runDataMigration(name string, migrate func() error) {
+	if err := db.AutoMigrate(&DataMigration{}); err != nil {
+		fmt.Println("failed to migrate data migrations table:", err)
+		return
+	}
+
+	var applied int64
+	db.Model(&DataMigration{}).Where("name = ?", name).Count(&applied)
+	if applied > 0 {
+		return
+	}
+
+	if err := migrate(); err != nil {
+		fmt.Printf("data migration %s failed: %v\n", name, err)
+		return
+	}
+
+	if err := db.Create(&DataMigration{Name: name, AppliedAt: time.Now()}).Error; err != nil {
+		fmt.Printf("failed to record data migration %s: %v\n", name, err)
+	}
+}
@@ -0,0 +1,133 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"api/pkg/config"
+	"api/pkg/finance"
+
+	"gorm.io/gorm"
+)
+
+// Kinds of financing a creative deal can carry
+const (
+	FinancingSubjectTo    = "subject_to"   // buyer takes over the seller's existing loan
+	FinancingSellerCarry  = "seller_carry" // seller finances part or all of the price
+	FinancingWrap         = "wrap"         // wrap-around mortgage over an existing loan
+	FinancingConventional = "conventional"
+	FinancingHardMoney    = "hard_money"
+	FinancingPrivate      = "private"
+	FinancingLeaseOption  = "lease_option"
+)
+
+var financingTypes = []string{
+	FinancingSubjectTo, FinancingSellerCarry, FinancingWrap, FinancingConventional,
+	FinancingHardMoney, FinancingPrivate, FinancingLeaseOption,
+}
+
+// FinancingTerm is one loan on a property, e.g. the existing mortgage in a
+// subject-to deal plus a seller carry-back for the rest
+type FinancingTerm struct {
+	gorm.Model
+	PropertyID   uint          `json:"property_id" gorm:"index;not null"`
+	Property     *Property     `json:"-" gorm:"constraint:OnDelete:CASCADE"`
+	Type         string        `json:"type" gorm:"type:varchar(32);not null"`
+	Position     int           `json:"position" gorm:"not null;default:1"` // lien position, 1 = first
+	LoanBalance  float64       `json:"loan_balance" gorm:"type:decimal(12,2);not null"`
+	InterestRate float64       `json:"interest_rate" gorm:"type:decimal(6,3);not null"` // annual, percent
+	TermMonths   *int          `json:"term_months"`                                     // remaining term
+	Payment      *float64      `json:"monthly_payment" gorm:"type:decimal(12,2)"`       // principal and interest; computed from the term when empty
+	FirstPayment *finance.Date `json:"first_payment_date" gorm:"type:date"`             // next payment due
+	BalloonDate  *finance.Date `json:"balloon_date" gorm:"type:date"`
+	Notes        *string       `json:"notes" gorm:"type:text"`
+}
+
+func init() {
+	db = config.GetDB()
+	db.AutoMigrate(&FinancingTerm{})
+}
+
+func GetFinancingTerms(propertyID uint) []FinancingTerm {
+	var terms []FinancingTerm
+	db.Where("property_id = ?", propertyID).Order("position, id").Find(&terms)
+	return terms
+}
+
+func GetFinancingTerm(propertyID uint, ID uint) (*FinancingTerm, error) {
+	var term FinancingTerm
+	if err := db.Where("property_id = ?", propertyID).First(&term, ID).Error; err != nil {
+		return nil, err
+	}
+	return &term, nil
+}
+
+// Save creates or updates the term
+func (t *FinancingTerm) Save() error {
+	return db.Save(t).Error
+}
+
+func (t *FinancingTerm) Delete() error {
+	return db.Delete(t).Error
+}
+
+// Validate checks the values a client can set on a financing term
+func (t *FinancingTerm) Validate() error {
+	valid := false
+	for _, kind := range financingTypes {
+		if t.Type == kind {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return fmt.Errorf("type must be one of %v", financingTypes)
+	}
+
+	if t.Position < 1 {
+		return fmt.Errorf("position must be at least 1")
+	}
+	if t.LoanBalance <= 0 {
+		return fmt.Errorf("loan_balance must be positive")
+	}
+	if t.InterestRate < 0 || t.InterestRate > 100 {
+		return fmt.Errorf("interest_rate must be a percentage between 0 and 100")
+	}
+	if t.TermMonths != nil && (*t.TermMonths < 1 || *t.TermMonths > finance.MaxScheduleMonths) {
+		return fmt.Errorf("term_months must be between 1 and %d", finance.MaxScheduleMonths)
+	}
+	if t.Payment != nil && *t.Payment <= 0 {
+		return fmt.Errorf("monthly_payment must be positive")
+	}
+	if t.TermMonths == nil && t.Payment == nil {
+		return fmt.Errorf("term_months or monthly_payment is required")
+	}
+	if t.BalloonDate != nil && t.FirstPayment != nil && t.BalloonDate.Before(t.FirstPayment.Time) {
+		return fmt.Errorf("balloon_date must not be before first_payment_date")
+	}
+	return nil
+}
+
+// Loan returns the term in the form finance.Amortize takes. Without a
+// first payment date the schedule starts on the first of next month.
+func (t *FinancingTerm) Loan() finance.Loan {
+	loan := finance.Loan{
+		Balance:      t.LoanBalance,
+		InterestRate: t.InterestRate,
+		BalloonDate:  t.BalloonDate,
+	}
+	if t.TermMonths != nil {
+		loan.TermMonths = *t.TermMonths
+	}
+	if t.Payment != nil {
+		loan.Payment = *t.Payment
+	}
+
+	if t.FirstPayment != nil {
+		loan.FirstPayment = *t.FirstPayment
+	} else {
+		now := time.Now()
+		loan.FirstPayment = finance.NewDate(time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)).AddMonths(1)
+	}
+	return loan
+}
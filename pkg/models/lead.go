@@ -0,0 +1,147 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"api/pkg/config"
+
+	"gorm.io/gorm"
+)
+
+// Where a lead is in the sales process
+const (
+	LeadNew       = "new"
+	LeadContacted = "contacted"
+	LeadQualified = "qualified"
+	LeadClosed    = "closed"
+)
+
+var leadStatuses = []string{LeadNew, LeadContacted, LeadQualified, LeadClosed}
+
+var ErrLeadNotFound = errors.New("lead not found")
+
+// Lead is a buyer's inquiry about a property, sent from the buyers' site and
+// worked by employees in the leads inbox
+type Lead struct {
+	gorm.Model
+	PropertyID  uint       `json:"property_id" gorm:"index;not null"`
+	Property    *Property  `json:"-" gorm:"constraint:OnDelete:CASCADE"`
+	UserID      *uint      `json:"user_id" gorm:"index"` // the buyer, when signed in
+	User        *User      `json:"-" gorm:"constraint:OnDelete:SET NULL"`
+	Name        string     `json:"name" gorm:"type:varchar(255);not null"`
+	Email       string     `json:"email" gorm:"type:varchar(255);index;not null"`
+	Phone       *string    `json:"phone" gorm:"type:varchar(32)"`
+	Message     *string    `json:"message" gorm:"type:text"`
+	OfferAmount *float64   `json:"offer_amount" gorm:"type:decimal(12,2)"`
+	Status      string     `json:"status" gorm:"type:varchar(16);index;not null;default:new"`
+	RoutedTo    *string    `json:"routed_to" gorm:"type:varchar(255)"` // who was emailed the inquiry
+	IPAddress   string     `json:"-" gorm:"type:varchar(45)"`
+	Notes       []LeadNote `json:"notes,omitempty" gorm:"constraint:OnDelete:CASCADE"`
+}
+
+// LeadNote is an employee's note on a lead, e.g. the outcome of a call
+type LeadNote struct {
+	gorm.Model
+	LeadID   uint   `json:"lead_id" gorm:"index;not null"`
+	AuthorID *uint  `json:"author_id"`
+	Author   *User  `json:"-" gorm:"foreignKey:AuthorID;constraint:OnDelete:SET NULL"`
+	Body     string `json:"body" gorm:"type:text;not null"`
+}
+
+// LeadFilter narrows the leads inbox
+type LeadFilter struct {
+	Status     string
+	PropertyID *uint
+	Search     string // in the buyer's name and email
+}
+
+func init() {
+	db = config.GetDB()
+	db.AutoMigrate(&Lead{}, &LeadNote{})
+}
+
+// ValidLeadStatus reports whether status is a known lead status
+func ValidLeadStatus(status string) bool {
+	return oneOf(leadStatuses, status)
+}
+
+// Create stores a new lead
+func (l *Lead) Create() error {
+	l.Status = LeadNew
+	return db.Create(l).Error
+}
+
+// HasRecentLead reports whether the email already sent an inquiry about the
+// property since the given time, so repeated submissions are not stored
+// and emailed twice
+func HasRecentLead(propertyID uint, email string, since time.Time) bool {
+	var count int64
+	db.Model(&Lead{}).Where("property_id = ? AND LOWER(email) = ? AND created_at >= ?", propertyID, strings.ToLower(email), since).Count(&count)
+	return count > 0
+}
+
+// GetPaginatedLeads lists leads, newest first
+func GetPaginatedLeads(limit int, offset int, filter LeadFilter) ([]Lead, int64) {
+	var leads []Lead
+	var total int64
+
+	query := db.Model(&Lead{})
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.PropertyID != nil {
+		query = query.Where("property_id = ?", *filter.PropertyID)
+	}
+	if filter.Search != "" {
+		search := "%" + strings.ToLower(filter.Search) + "%"
+		query = query.Where("LOWER(name) LIKE ? OR LOWER(email) LIKE ?", search, search)
+	}
+
+	query.Count(&total)
+	query.Order("created_at DESC, id DESC").Limit(limit).Offset(offset).Find(&leads)
+
+	return leads, total
+}
+
+// GetLeadById loads a lead with its notes, oldest first
+func GetLeadById(ID uint) (*Lead, error) {
+	var lead Lead
+	err := db.Preload("Notes", func(tx *gorm.DB) *gorm.DB {
+		return tx.Order("created_at, id")
+	}).First(&lead, ID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrLeadNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &lead, nil
+}
+
+// SetRoutedTo records who was emailed the inquiry
+func (l *Lead) SetRoutedTo(email string) error {
+	l.RoutedTo = &email
+	return db.Model(l).Update("routed_to", email).Error
+}
+
+// SetStatus moves the lead to another status
+func (l *Lead) SetStatus(status string) error {
+	if !ValidLeadStatus(status) {
+		return fmt.Errorf("status must be one of %v", leadStatuses)
+	}
+	l.Status = status
+	return db.Model(l).Update("status", status).Error
+}
+
+// AddNote adds a note to the lead
+func (l *Lead) AddNote(authorID *uint, body string) (*LeadNote, error) {
+	note := &LeadNote{LeadID: l.ID, AuthorID: authorID, Body: body}
+	if err := db.Create(note).Error; err != nil {
+		return nil, err
+	}
+	l.Notes = append(l.Notes, *note)
+	return note, nil
+}
@@ -0,0 +1,300 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"api/pkg/config"
+	"api/pkg/finance"
+
+	"gorm.io/gorm"
+)
+
+// Where an offer stands. Only pending offers can be answered; every other
+// status is final, except that an accepted offer is later closed, or
+// withdrawn when the deal falls through.
+const (
+	OfferPending   = "pending"   // waiting for the other side
+	OfferCountered = "countered" // answered with a counter-offer
+	OfferAccepted  = "accepted"  // the property is under contract
+	OfferRejected  = "rejected"
+	OfferWithdrawn = "withdrawn"
+	OfferExpired   = "expired"
+	OfferClosed    = "closed" // the deal closed and the property is sold
+)
+
+// Sides of a negotiation: the buyer, and the seller represented by staff or
+// the user who submitted the property
+const (
+	PartyBuyer  = "buyer"
+	PartySeller = "seller"
+)
+
+var (
+	ErrOfferNotFound        = errors.New("offer not found")
+	ErrOfferNotPending      = errors.New("offer is no longer open")
+	ErrOfferNotAccepted     = errors.New("offer has not been accepted")
+	ErrOfferExpired         = errors.New("offer has expired")
+	ErrPropertyNotAvailable = errors.New("property is not available")
+)
+
+// HasAcceptedOffer reports whether the property is under contract through
+// an accepted offer
+func HasAcceptedOffer(propertyID uint) (bool, error) {
+	var accepted int64
+	err := db.Model(&Offer{}).Where("property_id = ? AND status = ?", propertyID, OfferAccepted).Count(&accepted).Error
+	return accepted > 0, err
+}
+
+// Offer is a proposal to buy a property on given terms. A counter-offer is
+// a new offer from the other party that answers the previous one, so a
+// negotiation is a chain of offers linked by CounterToID in which only the
+// latest can be pending.
+type Offer struct {
+	gorm.Model
+	PropertyID      uint          `json:"property_id" gorm:"index;not null"`
+	Property        *Property     `json:"-" gorm:"constraint:OnDelete:CASCADE"`
+	BuyerID         uint          `json:"buyer_id" gorm:"index;not null"`
+	Buyer           *User         `json:"-" gorm:"foreignKey:BuyerID;constraint:OnDelete:CASCADE"`
+	CounterToID     *uint         `json:"counter_to_id" gorm:"index"`            // the offer this one answers
+	Party           string        `json:"party" gorm:"type:varchar(8);not null"` // who made it
+	CreatedByUserID *uint         `json:"created_by_user_id"`
+	CreatedByUser   *User         `json:"-" gorm:"foreignKey:CreatedByUserID;constraint:OnDelete:SET NULL"`
+	Price           float64       `json:"price" gorm:"type:decimal(12,2);not null"`
+	DownPayment     *float64      `json:"down_payment" gorm:"type:decimal(12,2)"`
+	EarnestMoney    *float64      `json:"earnest_money" gorm:"type:decimal(12,2)"`
+	FinancingType   *string       `json:"financing_type" gorm:"type:varchar(32)"` // see financingTypes
+	InterestRate    *float64      `json:"interest_rate" gorm:"type:decimal(6,3)"` // annual, percent
+	TermMonths      *int          `json:"term_months"`
+	Terms           *string       `json:"terms" gorm:"type:text"` // anything else proposed
+	ClosingDate     *finance.Date `json:"closing_date" gorm:"type:date"`
+	ExpiresAt       *time.Time    `json:"expires_at"`
+	Status          string        `json:"status" gorm:"type:varchar(16);index;not null;default:pending"`
+	RespondedAt     *time.Time    `json:"responded_at"` // when it left pending
+}
+
+func init() {
+	db = config.GetDB()
+	db.AutoMigrate(&Offer{})
+}
+
+// Validate checks the terms a client can propose
+func (o *Offer) Validate() error {
+	if o.Price <= 0 {
+		return fmt.Errorf("price must be positive")
+	}
+	if o.DownPayment != nil && (*o.DownPayment < 0 || *o.DownPayment > o.Price) {
+		return fmt.Errorf("down_payment must be between 0 and the price")
+	}
+	if o.EarnestMoney != nil && *o.EarnestMoney < 0 {
+		return fmt.Errorf("earnest_money must not be negative")
+	}
+	if o.FinancingType != nil && !oneOf(financingTypes, *o.FinancingType) {
+		return fmt.Errorf("financing_type must be one of %v", financingTypes)
+	}
+	if o.InterestRate != nil && (*o.InterestRate < 0 || *o.InterestRate > 100) {
+		return fmt.Errorf("interest_rate must be a percentage between 0 and 100")
+	}
+	if o.TermMonths != nil && (*o.TermMonths < 1 || *o.TermMonths > finance.MaxScheduleMonths) {
+		return fmt.Errorf("term_months must be between 1 and %d", finance.MaxScheduleMonths)
+	}
+	return nil
+}
+
+// expireOffers marks pending offers whose expiration has passed as expired
+func expireOffers(tx *gorm.DB) error {
+	now := time.Now()
+	return tx.Model(&Offer{}).
+		Where("status = ? AND expires_at IS NOT NULL AND expires_at <= ?", OfferPending, now).
+		Updates(map[string]interface{}{"status": OfferExpired, "responded_at": now}).Error
+}
+
+// GetPropertyOffers lists the offers on a property, newest first. With a
+// buyer ID only that buyer's offers are listed.
+func GetPropertyOffers(propertyID uint, buyerID *uint) []Offer {
+	expireOffers(db)
+
+	var offers []Offer
+	query := db.Where("property_id = ?", propertyID)
+	if buyerID != nil {
+		query = query.Where("buyer_id = ?", *buyerID)
+	}
+	query.Order("created_at DESC, id DESC").Find(&offers)
+	return offers
+}
+
+// GetBuyerOffers lists a buyer's offers on every property, newest first
+func GetBuyerOffers(buyerID uint) []Offer {
+	expireOffers(db)
+
+	var offers []Offer
+	db.Where("buyer_id = ?", buyerID).Order("created_at DESC, id DESC").Find(&offers)
+	return offers
+}
+
+func GetOfferById(ID uint) (*Offer, error) {
+	expireOffers(db)
+
+	var offer Offer
+	err := db.First(&offer, ID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrOfferNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &offer, nil
+}
+
+// SubmitOffer stores a buyer's opening offer. The property must be
+// available.
+func SubmitOffer(o *Offer) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var available int64
+		tx.Model(&Property{}).Where("id = ? AND status = ?", o.PropertyID, PropertyAvailable).Count(&available)
+		if available == 0 {
+			return ErrPropertyNotAvailable
+		}
+
+		o.Party = PartyBuyer
+		o.Status = OfferPending
+		o.CounterToID = nil
+		return tx.Create(o).Error
+	})
+}
+
+// Counter answers a pending offer with a counter-offer from the other
+// party, on the terms of counter
+func (o *Offer) Counter(counter *Offer) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := o.transition(tx, OfferPending, OfferCountered); err != nil {
+			return err
+		}
+
+		counter.PropertyID = o.PropertyID
+		counter.BuyerID = o.BuyerID
+		counter.CounterToID = &o.ID
+		counter.Party = PartyBuyer
+		if o.Party == PartyBuyer {
+			counter.Party = PartySeller
+		}
+		counter.Status = OfferPending
+		return tx.Create(counter).Error
+	})
+}
+
+// Accept accepts a pending offer, puts the property under contract and
+// rejects the other pending offers on it. It fails with
+// ErrPropertyNotAvailable while another offer is accepted.
+func (o *Offer) Accept() error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := o.transition(tx, OfferPending, OfferAccepted); err != nil {
+			return err
+		}
+		if err := setPropertyStatus(tx, o.PropertyID, PropertyAvailable, PropertyUnderContract); err != nil {
+			return err
+		}
+		return rejectOtherOffers(tx, o.PropertyID, o.ID)
+	})
+}
+
+// Reject turns down a pending offer
+func (o *Offer) Reject() error {
+	return o.transition(db, OfferPending, OfferRejected)
+}
+
+// Withdraw takes back a pending offer or, when the deal falls through, an
+// accepted one, which puts the property back on the market
+func (o *Offer) Withdraw() error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if o.Status != OfferAccepted {
+			return o.transition(tx, OfferPending, OfferWithdrawn)
+		}
+		if err := o.transition(tx, OfferAccepted, OfferWithdrawn); err != nil {
+			return err
+		}
+		// Staff may have changed the status by hand meanwhile; leave it then
+		return ignoreUnavailable(setPropertyStatus(tx, o.PropertyID, PropertyUnderContract, PropertyAvailable))
+	})
+}
+
+// Close records that the deal of an accepted offer closed, marks the
+// property sold and rejects any offers on it still pending
+func (o *Offer) Close() error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := o.transition(tx, OfferAccepted, OfferClosed); err != nil {
+			if errors.Is(err, ErrOfferNotPending) {
+				return ErrOfferNotAccepted
+			}
+			return err
+		}
+		if err := ignoreUnavailable(setPropertyStatus(tx, o.PropertyID, PropertyUnderContract, PropertySold)); err != nil {
+			return err
+		}
+		return rejectOtherOffers(tx, o.PropertyID, o.ID)
+	})
+}
+
+// rejectOtherOffers turns down the pending offers on a property except
+// offerID, once the property is no longer available to them
+func rejectOtherOffers(tx *gorm.DB, propertyID uint, offerID uint) error {
+	return tx.Model(&Offer{}).
+		Where("property_id = ? AND status = ? AND id <> ?", propertyID, OfferPending, offerID).
+		Updates(map[string]interface{}{"status": OfferRejected, "responded_at": time.Now()}).Error
+}
+
+// transition moves the offer from one status to another, provided nobody
+// else moved it first. A pending offer past its expiration is marked expired
+// instead and ErrOfferExpired returned.
+func (o *Offer) transition(tx *gorm.DB, from string, to string) error {
+	now := time.Now()
+	if from == OfferPending && o.ExpiresAt != nil && !o.ExpiresAt.After(now) {
+		// Outside tx, so that the expiry sticks when tx rolls back
+		expireOffers(db)
+		return ErrOfferExpired
+	}
+
+	updates := map[string]interface{}{"status": to}
+	if from == OfferPending {
+		updates["responded_at"] = now
+	}
+	result := tx.Model(&Offer{}).Where("id = ? AND status = ?", o.ID, from).Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrOfferNotPending
+	}
+
+	o.Status = to
+	if from == OfferPending {
+		o.RespondedAt = &now
+	}
+	return nil
+}
+
+// setPropertyStatus moves a property from one status to another and bumps
+// its version, failing with ErrPropertyNotAvailable when it is not in the
+// expected status
+func setPropertyStatus(tx *gorm.DB, propertyID uint, from string, to string) error {
+	result := tx.Model(&Property{}).Where("id = ? AND status = ?", propertyID, from).Updates(map[string]interface{}{
+		"status":  to,
+		"sold":    to == PropertySold,
+		"version": gorm.Expr("version + 1"),
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrPropertyNotAvailable
+	}
+	return nil
+}
+
+func ignoreUnavailable(err error) error {
+	if errors.Is(err, ErrPropertyNotAvailable) {
+		return nil
+	}
+	return err
+}
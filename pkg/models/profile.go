@@ -0,0 +1,95 @@
+package models
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// NotificationPreferences are the emails a user has opted into
+type NotificationPreferences struct {
+	NewProperties bool `json:"new_properties"` // new deals matching the site
+	PriceChanges  bool `json:"price_changes"`  // price drops on deals
+	Newsletter    bool `json:"newsletter"`
+}
+
+// Profile columns a user may change about themselves
+var profileColumns = []string{"name", "phone", "company", "avatar_url", "notification_preferences"}
+
+// ValidateProfile checks the profile fields a user can set
+func (u *User) ValidateProfile() error {
+	if u.Name != nil && len(*u.Name) > 255 {
+		return fmt.Errorf("name must be at most 255 characters")
+	}
+	if u.Company != nil && len(*u.Company) > 255 {
+		return fmt.Errorf("company must be at most 255 characters")
+	}
+
+	if u.Phone != nil {
+		digits := 0
+		for _, c := range *u.Phone {
+			switch {
+			case c >= '0' && c <= '9':
+				digits++
+			case strings.ContainsRune("+-() .", c):
+			default:
+				return fmt.Errorf("phone may only contain digits, spaces and + - ( ) .")
+			}
+		}
+		if digits < 7 || digits > 15 || len(*u.Phone) > 32 {
+			return fmt.Errorf("phone must have between 7 and 15 digits")
+		}
+	}
+
+	if u.AvatarURL != nil {
+		parsed, err := url.Parse(*u.AvatarURL)
+		if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" || len(*u.AvatarURL) > 2048 {
+			return fmt.Errorf("avatar_url must be an http(s) URL")
+		}
+	}
+
+	return nil
+}
+
+// UpdateProfile stores the profile fields
+func (u *User) UpdateProfile() error {
+	return db.Model(u).Select(profileColumns).Updates(u).Error
+}
+
+// Close deletes the account at the user's request. Personal data is erased
+// and the email is freed for a new registration; properties the user
+// submitted stay listed. The last active admin cannot close their account.
+func (u *User) Close() error {
+	if u.IsAdmin && !u.IsDisabled() {
+		if err := u.ensureAnotherAdmin(); err != nil {
+			return err
+		}
+	}
+
+	// Sign the user out everywhere
+	if err := RevokeUserTokens(u.ID); err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		u.Email = fmt.Sprintf("deleted-%d@deleted.invalid", u.ID)
+		u.Password = ""
+		u.Name, u.Phone, u.Company, u.AvatarURL = nil, nil, nil, nil
+		u.NotificationPreferences = NotificationPreferences{}
+		u.TOTPSecret, u.TwoFactorEnabledAt = nil, nil
+		u.DisabledAt = &now
+
+		columns := append([]string{"email", "password", "totp_secret", "two_factor_enabled_at", "disabled_at"}, profileColumns...)
+		if err := tx.Model(u).Select(columns).Updates(u).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", u.ID).Delete(&RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(u).Error
+	})
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"api/pkg/address"
+)
+
+// NormalizeAddress fills the structured address columns from Address and,
+// when a geocoder is given and the property has no coordinates yet, looks
+// up its latitude and longitude. Geocoding failures leave the coordinates
+// empty; the property is still saved and can be backfilled later.
+func (p *Property) NormalizeAddress(geocoder address.Geocoder) error {
+	components := address.Parse(p.Address)
+
+	p.Street = optionalString(components.Street)
+	p.Unit = optionalString(components.Unit)
+	p.City = optionalString(components.City)
+	p.State = optionalString(components.State)
+	p.Zip = optionalString(components.Zip)
+
+	// The county rarely appears in a free-form address, so keep one that was
+	// set explicitly
+	if components.County != "" {
+		p.County = &components.County
+	}
+
+	if geocoder == nil || p.Address == "" || (p.Latitude != nil && p.Longitude != nil) {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	location, err := geocoder.Geocode(ctx, p.Address)
+	if err != nil {
+		return err
+	}
+
+	p.Latitude = &location.Latitude
+	p.Longitude = &location.Longitude
+	if p.City == nil {
+		p.City = optionalString(location.City)
+	}
+	if p.State == nil {
+		p.State = optionalString(location.State)
+	}
+	if p.Zip == nil {
+		p.Zip = optionalString(location.Zip)
+	}
+
+	return nil
+}
+
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,106 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// PropertyCursor marks a position in a created_at ordered listing. It is
+// handed to clients as an opaque base64 string.
+type PropertyCursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        uint      `json:"id"`
+	Backward  bool      `json:"b,omitempty"` // page towards the start of the listing
+}
+
+func (c *PropertyCursor) Encode() string {
+	if c == nil {
+		return ""
+	}
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodePropertyCursor parses a cursor produced by Encode. An empty string
+// means "first page" and returns a nil cursor.
+func DecodePropertyCursor(s string) (*PropertyCursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var cursor PropertyCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID == 0 {
+		return nil, ErrInvalidCursor
+	}
+	return &cursor, nil
+}
+
+// GetPropertiesByCursor returns up to limit properties after (or, for a
+// backward cursor, before) the given cursor using keyset pagination on
+// (created_at, id). The filter must be sorted by created_at. Alongside the
+// page it returns the filtered total and the cursors for the neighbouring
+// pages, which are nil when there is nothing more in that direction.
+func GetPropertiesByCursor(limit int, cursor *PropertyCursor, filter *PropertyFilter) ([]Property, int64, *PropertyCursor, *PropertyCursor) {
+	var properties []Property
+	var total int64
+	if limit < 1 {
+		return properties, total, nil, nil
+	}
+
+	filter.Where(db.Model(&Property{})).Count(&total)
+
+	descending := filter == nil || filter.Order == "desc"
+	backward := cursor != nil && cursor.Backward
+
+	// Walking backwards through a listing is walking forwards through the
+	// reversed listing
+	scanDescending := descending != backward
+	comparison, direction := ">", "ASC"
+	if scanDescending {
+		comparison, direction = "<", "DESC"
+	}
+
+	query := filter.Where(db.Model(&Property{}))
+	if cursor != nil {
+		query = query.Where("(created_at "+comparison+" ?) OR (created_at = ? AND id "+comparison+" ?)",
+			cursor.CreatedAt, cursor.CreatedAt, cursor.ID)
+	}
+
+	// Fetch one extra row to find out whether another page exists
+	columns, args := filter.Columns()
+	withImages(query.Select(columns, args...)).Order("created_at " + direction + ", id " + direction).Limit(limit + 1).Find(&properties)
+
+	hasMore := len(properties) > limit
+	if hasMore {
+		properties = properties[:limit]
+	}
+
+	if backward {
+		for i, j := 0, len(properties)-1; i < j; i, j = i+1, j-1 {
+			properties[i], properties[j] = properties[j], properties[i]
+		}
+	}
+
+	if len(properties) == 0 {
+		return properties, total, nil, nil
+	}
+
+	first, last := properties[0], properties[len(properties)-1]
+
+	var next, prev *PropertyCursor
+	if hasMore || backward {
+		next = &PropertyCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+	if (backward && hasMore) || (!backward && cursor != nil) {
+		prev = &PropertyCursor{CreatedAt: first.CreatedAt, ID: first.ID, Backward: true}
+	}
+
+	return properties, total, next, prev
+}
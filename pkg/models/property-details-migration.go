@@ -0,0 +1,305 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"api/pkg/finance"
+
+	"gorm.io/gorm"
+)
+
+// PropertyLegacyField keeps the raw value a property detail had before it
+// was converted to a typed list, so nothing is lost when an old value
+// could not be read
+type PropertyLegacyField struct {
+	ID         uint      `gorm:"primarykey"`
+	CreatedAt  time.Time `gorm:"not null"`
+	PropertyID uint      `gorm:"index;not null"`
+	Field      string    `gorm:"type:varchar(64);not null"`
+	Value      string    `gorm:"type:longtext;not null"`
+}
+
+// legacyPropertyDetails are the detail columns as they were stored before
+// they were typed: free-form JSON, or for images also delimited URLs
+type legacyPropertyDetails struct {
+	ID                uint
+	Images            *string
+	PriceHistory      *string
+	TaxHistory        *string
+	NearbySchools     *string
+	NearbyHospitals   *string
+	NearbyHomes       *string
+	ContactRecipients *string
+}
+
+// migratePropertyDetails converts the raw JSON detail columns of existing
+// properties to the typed lists and the legacy images column to
+// property_images rows. Raw values are copied to property_legacy_fields
+// first, and values that cannot be read are cleared.
+func migratePropertyDetails() error {
+	if err := db.AutoMigrate(&PropertyImage{}, &PropertyLegacyField{}); err != nil {
+		return err
+	}
+
+	columns := []string{"id", "price_history", "tax_history", "nearby_schools", "nearby_hospitals", "nearby_homes", "contact_recipients"}
+	// Databases created after the change never had the images column
+	if db.Migrator().HasColumn(&Property{}, "images") {
+		columns = append(columns, "images")
+	}
+
+	var rows []legacyPropertyDetails
+	return db.Table("properties").Select(columns).FindInBatches(&rows, 100, func(tx *gorm.DB, batch int) error {
+		for _, row := range rows {
+			if err := migrateLegacyPropertyDetails(row); err != nil {
+				return fmt.Errorf("property %d: %w", row.ID, err)
+			}
+		}
+		return nil
+	}).Error
+}
+
+func migrateLegacyPropertyDetails(row legacyPropertyDetails) error {
+	raw := map[string]*string{
+		"price_history":      row.PriceHistory,
+		"tax_history":        row.TaxHistory,
+		"nearby_schools":     row.NearbySchools,
+		"nearby_hospitals":   row.NearbyHospitals,
+		"nearby_homes":       row.NearbyHomes,
+		"contact_recipients": row.ContactRecipients,
+	}
+	convert := map[string]func(string) (interface{}, error){
+		"price_history": func(s string) (interface{}, error) { return legacyPriceHistory(s) },
+		"tax_history":   func(s string) (interface{}, error) { return legacyTaxHistory(s) },
+		"nearby_schools": func(s string) (interface{}, error) {
+			return legacyList(s, func(school NearbySchool) bool { return school.Name != "" })
+		},
+		"nearby_hospitals": func(s string) (interface{}, error) {
+			return legacyList(s, func(hospital NearbyPlace) bool { return hospital.Name != "" })
+		},
+		"nearby_homes": func(s string) (interface{}, error) {
+			return legacyList(s, func(home NearbyHome) bool { return home.Address != "" })
+		},
+		"contact_recipients": func(s string) (interface{}, error) {
+			return legacyList(s, func(recipient ContactRecipient) bool { return recipient.DisplayName != "" })
+		},
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		var backedUp int64
+		tx.Model(&PropertyLegacyField{}).Where("property_id = ?", row.ID).Count(&backedUp)
+
+		updates := map[string]interface{}{}
+		for column, value := range raw {
+			if value == nil {
+				continue
+			}
+			if backedUp == 0 {
+				if err := tx.Create(&PropertyLegacyField{PropertyID: row.ID, Field: column, Value: *value}).Error; err != nil {
+					return err
+				}
+			}
+
+			updates[column] = nil
+			if trimmed := strings.TrimSpace(*value); trimmed == "" || trimmed == "null" {
+				continue
+			}
+			list, err := convert[column](*value)
+			if err != nil {
+				fmt.Printf("property %d: clearing unreadable %s: %v\n", row.ID, column, err)
+				continue
+			}
+			canonical, err := json.Marshal(list)
+			if err != nil {
+				return err
+			}
+			updates[column] = string(canonical)
+		}
+
+		if row.Images != nil && strings.TrimSpace(*row.Images) != "" {
+			if backedUp == 0 {
+				if err := tx.Create(&PropertyLegacyField{PropertyID: row.ID, Field: "images", Value: *row.Images}).Error; err != nil {
+					return err
+				}
+			}
+			if err := migrateLegacyImages(tx, row.ID, *row.Images); err != nil {
+				return err
+			}
+		}
+
+		if len(updates) == 0 {
+			return nil
+		}
+		return tx.Table("properties").Where("id = ?", row.ID).UpdateColumns(updates).Error
+	})
+}
+
+// migrateLegacyImages stores the URLs of a legacy images value as
+// property_images rows, unless the property already has images
+func migrateLegacyImages(tx *gorm.DB, propertyID uint, raw string) error {
+	var existing int64
+	tx.Model(&PropertyImage{}).Where("property_id = ?", propertyID).Count(&existing)
+	if existing > 0 {
+		return nil
+	}
+
+	var images PropertyImages
+	if err := json.Unmarshal([]byte(raw), &images); err != nil {
+		// Not JSON at all: a bare list of URLs
+		for _, imageURL := range splitImageURLs(raw) {
+			images = append(images, PropertyImage{URL: imageURL})
+		}
+	}
+
+	position := 0
+	seen := map[string]bool{}
+	for _, image := range images {
+		imageURL := strings.TrimSpace(image.URL)
+		if !validImageURL(imageURL) || seen[imageURL] {
+			continue
+		}
+		seen[imageURL] = true
+		if err := tx.Create(&PropertyImage{PropertyID: propertyID, URL: imageURL, Position: position, Cover: position == 0, Caption: image.Caption}).Error; err != nil {
+			return err
+		}
+		position++
+	}
+	return nil
+}
+
+// legacyItems splits a legacy JSON value into its array elements. A single
+// object is read as a one element array.
+func legacyItems(raw string) ([]json.RawMessage, error) {
+	var items []json.RawMessage
+	if err := json.Unmarshal([]byte(raw), &items); err == nil {
+		return items, nil
+	}
+
+	var item json.RawMessage
+	if err := json.Unmarshal([]byte(raw), &item); err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(strings.TrimSpace(string(item)), "{") {
+		return []json.RawMessage{item}, nil
+	}
+	return nil, fmt.Errorf("expected a JSON array")
+}
+
+// legacyList reads the elements of raw into T, dropping the ones that do
+// not decode or that keep rejects
+func legacyList[T any](raw string, keep func(T) bool) (JSONList[T], error) {
+	items, err := legacyItems(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	list := JSONList[T]{}
+	for _, item := range items {
+		var value T
+		if json.Unmarshal(item, &value) == nil && keep(value) {
+			list = append(list, value)
+		}
+	}
+	return list, nil
+}
+
+// legacyPriceHistory reads price events written either as {date, price}
+// or in Zillow's form with a millisecond time and an event label
+func legacyPriceHistory(raw string) (JSONList[PriceEvent], error) {
+	items, err := legacyItems(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	history := JSONList[PriceEvent]{}
+	for _, item := range items {
+		var fields map[string]interface{}
+		if json.Unmarshal(item, &fields) != nil {
+			continue
+		}
+
+		date, ok := legacyDate(fields["date"], fields["time"])
+		if !ok {
+			continue
+		}
+		event := PriceEvent{Date: date, Price: legacyNumber(fields["price"])}
+		if label, ok := fields["event"].(string); ok && label != "" {
+			event.Event = &label
+		}
+		history = append(history, event)
+	}
+	return history, nil
+}
+
+// legacyTaxHistory reads tax records written either as {year, tax} or in
+// Zillow's form {time, taxPaid, value}
+func legacyTaxHistory(raw string) (JSONList[TaxRecord], error) {
+	items, err := legacyItems(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	history := JSONList[TaxRecord]{}
+	for _, item := range items {
+		var fields map[string]interface{}
+		if json.Unmarshal(item, &fields) != nil {
+			continue
+		}
+
+		record := TaxRecord{}
+		if year := legacyNumber(fields["year"]); year != nil {
+			record.Year = int(*year)
+		} else if date, ok := legacyDate(nil, fields["time"]); ok {
+			record.Year = date.Year()
+		}
+		if record.Year < 1800 || record.Year > time.Now().Year()+1 {
+			continue
+		}
+
+		record.Tax = legacyNumber(fields["tax"])
+		if record.Tax == nil {
+			record.Tax = legacyNumber(fields["taxPaid"])
+		}
+		record.Assessment = legacyNumber(fields["assessment"])
+		if record.Assessment == nil {
+			record.Assessment = legacyNumber(fields["value"])
+		}
+		history = append(history, record)
+	}
+	return history, nil
+}
+
+var legacyDateLayouts = []string{finance.DateLayout, time.RFC3339, "2006-01-02 15:04:05", "01/02/2006", "1/2/2006"}
+
+// legacyDate reads a date string in one of the common layouts, falling
+// back to a Unix time in milliseconds
+func legacyDate(date interface{}, millis interface{}) (finance.Date, bool) {
+	if s, ok := date.(string); ok {
+		for _, layout := range legacyDateLayouts {
+			if t, err := time.Parse(layout, strings.TrimSpace(s)); err == nil {
+				return finance.NewDate(t), true
+			}
+		}
+	}
+	if ms := legacyNumber(millis); ms != nil && *ms > 0 {
+		return finance.NewDate(time.UnixMilli(int64(*ms)).UTC()), true
+	}
+	return finance.Date{}, false
+}
+
+// legacyNumber reads a JSON number or a numeric string such as "$295,000"
+func legacyNumber(value interface{}) *float64 {
+	switch v := value.(type) {
+	case float64:
+		return &v
+	case string:
+		cleaned := strings.NewReplacer("$", "", ",", "", " ", "").Replace(v)
+		if n, err := strconv.ParseFloat(cleaned, 64); err == nil {
+			return &n
+		}
+	}
+	return nil
+}
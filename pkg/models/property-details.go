@@ -0,0 +1,187 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"api/pkg/finance"
+)
+
+// JSONList is a list of details stored as a JSON array in a text column. It
+// is written as [] rather than null when empty.
+type JSONList[T any] []T
+
+func (l JSONList[T]) MarshalJSON() ([]byte, error) {
+	if l == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal([]T(l))
+}
+
+// PriceEvent is one entry of a property's price history
+type PriceEvent struct {
+	Date  finance.Date `json:"date"`
+	Price *float64     `json:"price"`
+	Event *string      `json:"event,omitempty"` // e.g. "Listed for sale", "Sold"
+}
+
+// TaxRecord is the property tax of one year
+type TaxRecord struct {
+	Year       int      `json:"year"`
+	Tax        *float64 `json:"tax"`
+	Assessment *float64 `json:"assessment,omitempty"` // assessed value
+}
+
+// NearbySchool is a school close to the property. A bare string is read as
+// the school's name.
+type NearbySchool struct {
+	Name     string   `json:"name"`
+	Level    *string  `json:"level,omitempty"`  // e.g. "Elementary"
+	Grades   *string  `json:"grades,omitempty"` // e.g. "K-5"
+	Rating   *float64 `json:"rating,omitempty"` // 1 to 10
+	Distance *float64 `json:"distance,omitempty"`
+	Link     *string  `json:"link,omitempty"`
+}
+
+func (s *NearbySchool) UnmarshalJSON(data []byte) error {
+	var name string
+	if json.Unmarshal(data, &name) == nil {
+		*s = NearbySchool{Name: name}
+		return nil
+	}
+
+	type school NearbySchool
+	return json.Unmarshal(data, (*school)(s))
+}
+
+// NearbyPlace is a place of interest close to the property, such as a
+// hospital. A bare string is read as the place's name.
+type NearbyPlace struct {
+	Name     string   `json:"name"`
+	Address  *string  `json:"address,omitempty"`
+	Distance *float64 `json:"distance,omitempty"` // miles
+	Link     *string  `json:"link,omitempty"`
+}
+
+func (p *NearbyPlace) UnmarshalJSON(data []byte) error {
+	var name string
+	if json.Unmarshal(data, &name) == nil {
+		*p = NearbyPlace{Name: name}
+		return nil
+	}
+
+	type place NearbyPlace
+	return json.Unmarshal(data, (*place)(p))
+}
+
+// NearbyHome is a comparable home in the neighbourhood. A bare string is
+// read as its address.
+type NearbyHome struct {
+	Address    string   `json:"address"`
+	Price      *float64 `json:"price,omitempty"`
+	Bedrooms   *int     `json:"bedrooms,omitempty"`
+	Bathrooms  *float64 `json:"bathrooms,omitempty"`
+	LivingArea *int     `json:"living_area,omitempty"`
+	ImageURL   *string  `json:"image_url,omitempty"`
+	Link       *string  `json:"link,omitempty"`
+}
+
+func (h *NearbyHome) UnmarshalJSON(data []byte) error {
+	var address string
+	if json.Unmarshal(data, &address) == nil {
+		*h = NearbyHome{Address: address}
+		return nil
+	}
+
+	type home NearbyHome
+	return json.Unmarshal(data, (*home)(h))
+}
+
+// ContactRecipient is an agent inquiries about the property go to, as
+// listed by Zillow
+type ContactRecipient struct {
+	DisplayName   string        `json:"display_name"`
+	BadgeType     *string       `json:"badge_type"`
+	Phone         *ContactPhone `json:"phone"`
+	ImageURL      *string       `json:"image_url"`
+	RatingAverage *float64      `json:"rating_average"`
+	ReviewCount   *int          `json:"review_count"`
+	RecentSales   *int          `json:"recent_sales"`
+	AgentReason   *int          `json:"agent_reason"`
+	Zpro          *bool         `json:"zpro"`
+	Zuid          *string       `json:"zuid"`
+}
+
+type ContactPhone struct {
+	Areacode string `json:"areacode"`
+	Prefix   string `json:"prefix"`
+	Number   string `json:"number"`
+}
+
+// validateDetails checks the images and the typed detail lists
+func (p *Property) validateDetails() error {
+	if err := p.validateImages(); err != nil {
+		return err
+	}
+
+	for _, event := range p.PriceHistory {
+		if event.Date.IsZero() {
+			return fmt.Errorf("price_history entries need a date")
+		}
+		if event.Price != nil && *event.Price < 0 {
+			return fmt.Errorf("price_history prices must not be negative")
+		}
+	}
+
+	for _, record := range p.TaxHistory {
+		if record.Year < 1800 || record.Year > time.Now().Year()+1 {
+			return fmt.Errorf("tax_history year is out of range")
+		}
+		if (record.Tax != nil && *record.Tax < 0) || (record.Assessment != nil && *record.Assessment < 0) {
+			return fmt.Errorf("tax_history amounts must not be negative")
+		}
+	}
+
+	for _, school := range p.NearbySchools {
+		if strings.TrimSpace(school.Name) == "" {
+			return fmt.Errorf("nearby_schools entries need a name")
+		}
+		if school.Rating != nil && (*school.Rating < 0 || *school.Rating > 10) {
+			return fmt.Errorf("nearby_schools rating must be between 0 and 10")
+		}
+		if school.Distance != nil && *school.Distance < 0 {
+			return fmt.Errorf("nearby_schools distance must not be negative")
+		}
+	}
+
+	for _, hospital := range p.NearbyHospitals {
+		if strings.TrimSpace(hospital.Name) == "" {
+			return fmt.Errorf("nearby_hospitals entries need a name")
+		}
+		if hospital.Distance != nil && *hospital.Distance < 0 {
+			return fmt.Errorf("nearby_hospitals distance must not be negative")
+		}
+	}
+
+	for _, home := range p.NearbyHomes {
+		if strings.TrimSpace(home.Address) == "" {
+			return fmt.Errorf("nearby_homes entries need an address")
+		}
+		if home.Price != nil && *home.Price < 0 {
+			return fmt.Errorf("nearby_homes price must not be negative")
+		}
+	}
+
+	for _, recipient := range p.ContactRecipients {
+		if strings.TrimSpace(recipient.DisplayName) == "" {
+			return fmt.Errorf("contact_recipients entries need a display_name")
+		}
+		if recipient.RatingAverage != nil && (*recipient.RatingAverage < 0 || *recipient.RatingAverage > 5) {
+			return fmt.Errorf("contact_recipients rating_average must be between 0 and 5")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,319 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"time"
+
+	"api/pkg/config"
+	"api/pkg/storage"
+
+	"gorm.io/gorm"
+)
+
+// Kinds of deal documents
+const (
+	DocumentPurchaseContract = "purchase_contract"
+	DocumentBenefitSheet     = "benefit_sheet"
+	DocumentTitleReport      = "title_report"
+	DocumentDisclosure       = "disclosure"
+	DocumentOther            = "other"
+)
+
+var documentTypes = []string{
+	DocumentPurchaseContract, DocumentBenefitSheet, DocumentTitleReport, DocumentDisclosure, DocumentOther,
+}
+
+// Who may see a document, from least to most restricted
+const (
+	VisibilityPublic = "public" // anyone
+	VisibilityNDA    = "nda"    // buyers who signed the property's NDA
+	VisibilityStaff  = "staff"  // staff and the user who submitted the property
+)
+
+var documentVisibilities = []string{VisibilityPublic, VisibilityNDA, VisibilityStaff}
+
+// Where uploaded documents are stored. Unlike images they are not public:
+// they are only served through signed download links.
+const documentKeyPrefix = "documents/"
+
+var ErrDocumentNotFound = errors.New("document not found")
+
+// PropertyDocument is a file attached to a deal: uploaded to storage, or a
+// link to a file hosted elsewhere such as a Google Sheet. Clients never see
+// where it is kept and download it through a signed link.
+type PropertyDocument struct {
+	ID               uint      `json:"id" gorm:"primarykey"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+	PropertyID       uint      `json:"property_id" gorm:"index;not null"`
+	Property         *Property `json:"-" gorm:"constraint:OnDelete:CASCADE"`
+	Type             string    `json:"type" gorm:"type:varchar(32);not null"`
+	Visibility       string    `json:"visibility" gorm:"type:varchar(16);not null;default:staff"`
+	Name             string    `json:"name" gorm:"type:varchar(255);not null"`
+	FileName         *string   `json:"file_name" gorm:"type:varchar(255)"`    // uploads only
+	ContentType      *string   `json:"content_type" gorm:"type:varchar(128)"` // uploads only
+	Size             *int64    `json:"size"`                                  // bytes, uploads only
+	StorageKey       *string   `json:"-" gorm:"type:varchar(512)"`
+	URL              *string   `json:"-" gorm:"type:varchar(2048)"` // links only
+	UploadedByUserID *uint     `json:"uploaded_by_user_id"`
+	UploadedByUser   *User     `json:"-" gorm:"foreignKey:UploadedByUserID;constraint:OnDelete:SET NULL"`
+}
+
+// NDASignature records that a user signed the non-disclosure agreement of
+// a property, which opens its NDA documents to them
+type NDASignature struct {
+	ID         uint      `json:"id" gorm:"primarykey"`
+	CreatedAt  time.Time `json:"signed_at"`
+	PropertyID uint      `json:"property_id" gorm:"uniqueIndex:idx_nda_signatures_property_user;not null"`
+	Property   *Property `json:"-" gorm:"constraint:OnDelete:CASCADE"`
+	UserID     uint      `json:"user_id" gorm:"uniqueIndex:idx_nda_signatures_property_user;index;not null"`
+	User       *User     `json:"-" gorm:"constraint:OnDelete:CASCADE"`
+	SignerName string    `json:"signer_name" gorm:"type:varchar(255);not null"`
+	IPAddress  string    `json:"-" gorm:"type:varchar(45)"`
+}
+
+func init() {
+	db = config.GetDB()
+	db.AutoMigrate(&PropertyDocument{}, &NDASignature{})
+	runDataMigration("property_document_links", migrateDocumentLinks)
+}
+
+// IsLink reports whether the document is hosted elsewhere
+func (d *PropertyDocument) IsLink() bool {
+	return d.StorageKey == nil && d.URL != nil
+}
+
+// VisibleTo reports whether a viewer with the given access may see the
+// document. Access is one of the visibilities: the most restricted level
+// the viewer can reach.
+func (d *PropertyDocument) VisibleTo(access string) bool {
+	switch access {
+	case VisibilityStaff:
+		return true
+	case VisibilityNDA:
+		return d.Visibility == VisibilityPublic || d.Visibility == VisibilityNDA
+	default:
+		return d.Visibility == VisibilityPublic
+	}
+}
+
+// Validate checks the values a client can set on a document
+func (d *PropertyDocument) Validate() error {
+	if !oneOf(documentTypes, d.Type) {
+		return fmt.Errorf("type must be one of %v", documentTypes)
+	}
+	if !oneOf(documentVisibilities, d.Visibility) {
+		return fmt.Errorf("visibility must be one of %v", documentVisibilities)
+	}
+	if d.Name == "" || len(d.Name) > 255 {
+		return fmt.Errorf("name is required and must be at most 255 characters")
+	}
+	return nil
+}
+
+func oneOf(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// GetPropertyDocuments lists the documents of a property a viewer with the
+// given access may see
+func GetPropertyDocuments(propertyID uint, access string) []PropertyDocument {
+	var documents []PropertyDocument
+	db.Where("property_id = ?", propertyID).Order("type, created_at, id").Find(&documents)
+
+	visible := make([]PropertyDocument, 0, len(documents))
+	for _, document := range documents {
+		if document.VisibleTo(access) {
+			visible = append(visible, document)
+		}
+	}
+	return visible
+}
+
+func GetPropertyDocument(propertyID uint, ID uint) (*PropertyDocument, error) {
+	var document PropertyDocument
+	err := db.Where("property_id = ?", propertyID).First(&document, ID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrDocumentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &document, nil
+}
+
+// GetDocument loads a document by ID alone, for signed download links
+func GetDocument(ID uint) (*PropertyDocument, error) {
+	var document PropertyDocument
+	err := db.First(&document, ID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrDocumentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &document, nil
+}
+
+// Save creates or updates the document
+func (d *PropertyDocument) Save() error {
+	return db.Save(d).Error
+}
+
+// Delete removes the document and its file. A file that cannot be deleted
+// is only logged.
+func (d *PropertyDocument) Delete() error {
+	if err := db.Delete(d).Error; err != nil {
+		return err
+	}
+	if d.StorageKey != nil {
+		deleteStorageKeys([]string{*d.StorageKey})
+	}
+	return nil
+}
+
+// StoreDocumentFile puts an uploaded document of the property in storage
+// and returns its key
+func StoreDocumentFile(ctx context.Context, propertyID uint, extension string, contentType string, body io.Reader, size int64) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	key := fmt.Sprintf("%sproperties/%d/%s%s", documentKeyPrefix, propertyID, hex.EncodeToString(b), extension)
+	if err := storage.Default().Put(ctx, key, body, size, contentType); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// Open opens the stored file of an uploaded document
+func (d *PropertyDocument) Open(ctx context.Context) (io.ReadCloser, error) {
+	if d.StorageKey == nil {
+		return nil, ErrDocumentNotFound
+	}
+	return storage.Default().Open(ctx, *d.StorageKey)
+}
+
+// HasSignedNDA reports whether the user signed the NDA of the property
+func HasSignedNDA(propertyID uint, userID uint) bool {
+	var count int64
+	db.Model(&NDASignature{}).Where("property_id = ? AND user_id = ?", propertyID, userID).Count(&count)
+	return count > 0
+}
+
+func GetNDASignature(propertyID uint, userID uint) (*NDASignature, error) {
+	var signature NDASignature
+	if err := db.Where("property_id = ? AND user_id = ?", propertyID, userID).First(&signature).Error; err != nil {
+		return nil, err
+	}
+	return &signature, nil
+}
+
+// SignNDA records the user's signature of the property's NDA. Signing again
+// returns the existing signature.
+func SignNDA(propertyID uint, userID uint, signerName string, ipAddress string) (*NDASignature, error) {
+	if existing, err := GetNDASignature(propertyID, userID); err == nil {
+		return existing, nil
+	}
+
+	signature := &NDASignature{
+		PropertyID: propertyID,
+		UserID:     userID,
+		SignerName: signerName,
+		IPAddress:  ipAddress,
+	}
+	if err := db.Create(signature).Error; err != nil {
+		return nil, err
+	}
+	return signature, nil
+}
+
+// legacyDocumentLinks are the URL columns documents were kept in before
+// the document vault
+type legacyDocumentLinks struct {
+	ID                     uint
+	TransactionDocumentUrl *string
+	BenefitSheetUrl        *string
+	DocsUrl                *string
+}
+
+// migrateDocumentLinks turns the transaction_document_url, benefit_sheet_url
+// and docs_url columns of existing properties into link documents. The
+// links were public on the property, so the documents are too; staff can
+// restrict them afterwards. The columns themselves are left untouched.
+func migrateDocumentLinks() error {
+	columns := []string{"id"}
+	for _, column := range []string{"transaction_document_url", "benefit_sheet_url", "docs_url"} {
+		// Databases created after the change never had the columns
+		if db.Migrator().HasColumn(&Property{}, column) {
+			columns = append(columns, column)
+		}
+	}
+	if len(columns) == 1 {
+		return nil
+	}
+
+	var rows []legacyDocumentLinks
+	return db.Table("properties").Select(columns).FindInBatches(&rows, 100, func(tx *gorm.DB, batch int) error {
+		for _, row := range rows {
+			if err := migrateLegacyDocumentLinks(row); err != nil {
+				return fmt.Errorf("property %d: %w", row.ID, err)
+			}
+		}
+		return nil
+	}).Error
+}
+
+func migrateLegacyDocumentLinks(row legacyDocumentLinks) error {
+	links := []struct {
+		url  *string
+		kind string
+		name string
+	}{
+		{row.TransactionDocumentUrl, DocumentPurchaseContract, "Transaction document"},
+		{row.BenefitSheetUrl, DocumentBenefitSheet, "Benefit sheet"},
+		{row.DocsUrl, DocumentOther, "Documents"},
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, link := range links {
+			if link.url == nil || !validDocumentURL(*link.url) {
+				continue
+			}
+			// A previous attempt may have got this far
+			var existing int64
+			tx.Model(&PropertyDocument{}).Where("property_id = ? AND url = ?", row.ID, *link.url).Count(&existing)
+			if existing > 0 {
+				continue
+			}
+
+			document := PropertyDocument{
+				PropertyID: row.ID,
+				Type:       link.kind,
+				Visibility: VisibilityPublic,
+				Name:       link.name,
+				URL:        link.url,
+			}
+			if err := tx.Create(&document).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func validDocumentURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && len(s) <= 2048
+}
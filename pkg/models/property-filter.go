@@ -0,0 +1,389 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Numeric columns that can be filtered with an exact value (price=300000)
+// or a range (price_min=100000&price_max=350000)
+var propertyNumericFilters = []string{
+	"price",
+	"bedrooms",
+	"bathrooms",
+	"living_area",
+	"lot_size",
+	"year_built",
+	"monthly_hoa_fee",
+	"assignment_fee",
+	"balance_to_close",
+	"interest_rate",
+}
+
+// Enum columns that accept one or more comma separated values
+// (property_type=Single Family,Condo)
+var propertyEnumFilters = []string{
+	"property_type",
+	"zoning",
+	"created_by",
+	"city",
+	"state",
+	"zip",
+	"county",
+	"status",
+}
+
+// Boolean columns (sold=false&in_house_deal=true)
+var propertyBoolFilters = []string{
+	"sold",
+	"in_house_deal",
+	"rental_restriction",
+}
+
+// Columns a listing can be sorted by, keyed by the value of the sort parameter
+var propertySortColumns = map[string]string{
+	"created_at":       "created_at",
+	"updated_at":       "updated_at",
+	"price":            "price",
+	"bedrooms":         "bedrooms",
+	"bathrooms":        "bathrooms",
+	"living_area":      "living_area",
+	"lot_size":         "lot_size",
+	"year_built":       "year_built",
+	"assignment_fee":   "assignment_fee",
+	"balance_to_close": "balance_to_close",
+	"interest_rate":    "interest_rate",
+	"relevance":        "relevance", // search only, see SearchProperties
+	"distance":         "distance",  // requires near, see Columns
+}
+
+// Radius used when near is given without one, and the largest accepted
+const (
+	defaultRadiusMiles = 10
+	maxRadiusMiles     = 500
+)
+
+// Mean radius of the earth and length of a degree of latitude, in miles
+const (
+	earthRadiusMiles = 3958.8
+	milesPerDegree   = 69.0
+)
+
+// GeoPoint is a WGS84 coordinate
+type GeoPoint struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// BoundingBox is the rectangle between two corners, as sent by a map view
+type BoundingBox struct {
+	MinLatitude  float64
+	MinLongitude float64
+	MaxLatitude  float64
+	MaxLongitude float64
+}
+
+// RangeFilter restricts a numeric column to [Min, Max]; either bound may be nil
+type RangeFilter struct {
+	Column string
+	Min    *float64
+	Max    *float64
+}
+
+// PropertyFilter is the parsed form of the GET /properties filter grammar
+type PropertyFilter struct {
+	Ranges []RangeFilter
+	Enums  map[string][]string
+	Bools  map[string]bool
+	Sort   string
+	Order  string
+
+	// Geospatial filters
+	Near        *GeoPoint
+	RadiusMiles float64
+	BBox        *BoundingBox
+
+	// Restricts the listing to one user's submissions. Not part of the query
+	// string grammar; set by handlers from the authenticated user.
+	CreatedByUserID *uint
+}
+
+// ParsePropertyFilter builds a PropertyFilter from query string parameters.
+// Unknown parameters are ignored so that callers can mix in their own
+// (page, pageSize, search, ...).
+func ParsePropertyFilter(values url.Values) (*PropertyFilter, error) {
+	filter := &PropertyFilter{
+		Enums: map[string][]string{},
+		Bools: map[string]bool{},
+		Sort:  "created_at",
+		Order: "desc",
+	}
+
+	for _, column := range propertyNumericFilters {
+		rangeFilter := RangeFilter{Column: column}
+
+		if exact := values.Get(column); exact != "" {
+			value, err := strconv.ParseFloat(exact, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s parameter", column)
+			}
+			rangeFilter.Min = &value
+			rangeFilter.Max = &value
+		}
+
+		if min := values.Get(column + "_min"); min != "" {
+			value, err := strconv.ParseFloat(min, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s_min parameter", column)
+			}
+			rangeFilter.Min = &value
+		}
+
+		if max := values.Get(column + "_max"); max != "" {
+			value, err := strconv.ParseFloat(max, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s_max parameter", column)
+			}
+			rangeFilter.Max = &value
+		}
+
+		if rangeFilter.Min != nil && rangeFilter.Max != nil && *rangeFilter.Min > *rangeFilter.Max {
+			return nil, fmt.Errorf("%s_min must not be greater than %s_max", column, column)
+		}
+
+		if rangeFilter.Min != nil || rangeFilter.Max != nil {
+			filter.Ranges = append(filter.Ranges, rangeFilter)
+		}
+	}
+
+	for _, column := range propertyEnumFilters {
+		raw := values.Get(column)
+		if raw == "" {
+			continue
+		}
+		var options []string
+		for _, option := range strings.Split(raw, ",") {
+			if option = strings.TrimSpace(option); option != "" {
+				options = append(options, option)
+			}
+		}
+		if len(options) > 0 {
+			filter.Enums[column] = options
+		}
+	}
+
+	for _, column := range propertyBoolFilters {
+		raw := values.Get(column)
+		if raw == "" {
+			continue
+		}
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s parameter", column)
+		}
+		filter.Bools[column] = value
+	}
+
+	if sort := values.Get("sort"); sort != "" {
+		if _, ok := propertySortColumns[sort]; !ok {
+			return nil, fmt.Errorf("invalid sort parameter")
+		}
+		filter.Sort = sort
+	}
+
+	if order := strings.ToLower(values.Get("order")); order != "" {
+		if order != "asc" && order != "desc" {
+			return nil, fmt.Errorf("order must be either 'asc' or 'desc'")
+		}
+		filter.Order = order
+	} else if filter.Sort == "distance" {
+		// Nearest first unless asked otherwise
+		filter.Order = "asc"
+	}
+
+	if near := values.Get("near"); near != "" {
+		coordinates, err := parseCoordinates(near, 2)
+		if err != nil || !validLatitude(coordinates[0]) || !validLongitude(coordinates[1]) {
+			return nil, fmt.Errorf("near must be formatted as lat,lng")
+		}
+		filter.Near = &GeoPoint{Latitude: coordinates[0], Longitude: coordinates[1]}
+		filter.RadiusMiles = defaultRadiusMiles
+
+		if radius := values.Get("radius"); radius != "" {
+			value, err := strconv.ParseFloat(radius, 64)
+			if err != nil || value <= 0 || value > maxRadiusMiles {
+				return nil, fmt.Errorf("radius must be a number of miles between 0 and %d", maxRadiusMiles)
+			}
+			filter.RadiusMiles = value
+		}
+	} else if values.Get("radius") != "" {
+		return nil, fmt.Errorf("radius requires a near parameter")
+	}
+
+	if bbox := values.Get("bbox"); bbox != "" {
+		coordinates, err := parseCoordinates(bbox, 4)
+		if err != nil ||
+			!validLongitude(coordinates[0]) || !validLatitude(coordinates[1]) ||
+			!validLongitude(coordinates[2]) || !validLatitude(coordinates[3]) ||
+			coordinates[0] > coordinates[2] || coordinates[1] > coordinates[3] {
+			return nil, fmt.Errorf("bbox must be formatted as minLng,minLat,maxLng,maxLat")
+		}
+		filter.BBox = &BoundingBox{
+			MinLongitude: coordinates[0],
+			MinLatitude:  coordinates[1],
+			MaxLongitude: coordinates[2],
+			MaxLatitude:  coordinates[3],
+		}
+	}
+
+	if filter.Sort == "distance" && filter.Near == nil {
+		return nil, fmt.Errorf("sort=distance requires a near parameter")
+	}
+
+	return filter, nil
+}
+
+// Where applies the filter conditions to query
+func (f *PropertyFilter) Where(query *gorm.DB) *gorm.DB {
+	if f == nil {
+		return query
+	}
+
+	for _, r := range f.Ranges {
+		if r.Min != nil && r.Max != nil && *r.Min == *r.Max {
+			query = query.Where(r.Column+" = ?", *r.Min)
+			continue
+		}
+		if r.Min != nil {
+			query = query.Where(r.Column+" >= ?", *r.Min)
+		}
+		if r.Max != nil {
+			query = query.Where(r.Column+" <= ?", *r.Max)
+		}
+	}
+
+	for _, column := range propertyEnumFilters {
+		if options, ok := f.Enums[column]; ok {
+			query = query.Where(column+" IN ?", options)
+		}
+	}
+
+	for _, column := range propertyBoolFilters {
+		if value, ok := f.Bools[column]; ok {
+			query = query.Where(column+" = ?", value)
+		}
+	}
+
+	if f.CreatedByUserID != nil {
+		query = query.Where("created_by_user_id = ?", *f.CreatedByUserID)
+	}
+
+	if f.BBox != nil {
+		query = withinEnvelope(query, f.BBox.MinLongitude, f.BBox.MinLatitude, f.BBox.MaxLongitude, f.BBox.MaxLatitude)
+	}
+
+	if f.Near != nil {
+		// Narrow down with a bounding box first so the spatial index does the
+		// heavy lifting, then apply the exact distance
+		latDelta := f.RadiusMiles / milesPerDegree
+		lngDelta := f.RadiusMiles / (milesPerDegree * math.Max(math.Cos(f.Near.Latitude*math.Pi/180), 0.01))
+
+		distance, args := f.distanceExpression()
+		query = withinEnvelope(query, f.Near.Longitude-lngDelta, f.Near.Latitude-latDelta, f.Near.Longitude+lngDelta, f.Near.Latitude+latDelta).
+			Where(distance+" <= ?", append(args, f.RadiusMiles)...)
+	}
+
+	return query
+}
+
+// Columns returns the select list for a listing: every property column,
+// plus the distance from the near point when there is one
+func (f *PropertyFilter) Columns() (string, []interface{}) {
+	if f == nil || f.Near == nil {
+		return "properties.*", nil
+	}
+	distance, args := f.distanceExpression()
+	return "properties.*, " + distance + " AS distance", args
+}
+
+// distanceExpression is the great-circle distance in miles between the
+// near point and a property's location
+func (f *PropertyFilter) distanceExpression() (string, []interface{}) {
+	expression := fmt.Sprintf("ST_Distance_Sphere(location, POINT(?, ?), %v)", earthRadiusMiles)
+	return expression, []interface{}{f.Near.Longitude, f.Near.Latitude}
+}
+
+// withinEnvelope keeps the properties located inside a longitude/latitude
+// rectangle. MBRContains on the location column uses its spatial index;
+// properties without coordinates sit at POINT(0, 0) there, so they are
+// excluded explicitly.
+func withinEnvelope(query *gorm.DB, minLng, minLat, maxLng, maxLat float64) *gorm.DB {
+	return query.Where("latitude IS NOT NULL AND longitude IS NOT NULL").
+		Where("MBRContains(ST_MakeEnvelope(POINT(?, ?), POINT(?, ?)), location)", minLng, minLat, maxLng, maxLat)
+}
+
+// Spatial index on properties.location, a stored POINT(longitude, latitude)
+// column generated from the coordinates. It replaces the B-tree index on
+// (latitude, longitude), which could only narrow down one of the two ranges.
+const propertyLocationIndex = "idx_properties_location"
+
+// migratePropertyLocationIndex adds the location column and its spatial
+// index. MySQL only indexes NOT NULL columns with an SRID, hence POINT(0, 0)
+// for properties without coordinates.
+func migratePropertyLocationIndex() {
+	if db.Migrator().HasIndex(&Property{}, "idx_properties_lat_lng") {
+		if err := db.Migrator().DropIndex(&Property{}, "idx_properties_lat_lng"); err != nil {
+			fmt.Println("failed to drop the latitude/longitude index:", err)
+		}
+	}
+
+	if !db.Migrator().HasColumn(&Property{}, "location") {
+		statement := "ALTER TABLE properties ADD COLUMN location POINT SRID 0 " +
+			"GENERATED ALWAYS AS (POINT(IFNULL(longitude, 0), IFNULL(latitude, 0))) STORED NOT NULL"
+		if err := db.Exec(statement).Error; err != nil {
+			fmt.Println("failed to add the location column:", err)
+			return
+		}
+	}
+
+	if !db.Migrator().HasIndex(&Property{}, propertyLocationIndex) {
+		statement := fmt.Sprintf("CREATE SPATIAL INDEX %s ON properties (location)", propertyLocationIndex)
+		if err := db.Exec(statement).Error; err != nil {
+			fmt.Println("failed to create the location index:", err)
+		}
+	}
+}
+
+func parseCoordinates(s string, n int) ([]float64, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != n {
+		return nil, fmt.Errorf("expected %d coordinates", n)
+	}
+	coordinates := make([]float64, n)
+	for i, part := range parts {
+		value, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, err
+		}
+		coordinates[i] = value
+	}
+	return coordinates, nil
+}
+
+func validLatitude(v float64) bool  { return v >= -90 && v <= 90 }
+func validLongitude(v float64) bool { return v >= -180 && v <= 180 }
+
+// OrderClause returns the ORDER BY clause for the filter, with the primary
+// key as a tie-breaker so that pages are stable
+func (f *PropertyFilter) OrderClause() string {
+	if f == nil {
+		return "created_at DESC, id DESC"
+	}
+	direction := strings.ToUpper(f.Order)
+	return fmt.Sprintf("%s %s, id %s", propertySortColumns[f.Sort], direction, direction)
+}
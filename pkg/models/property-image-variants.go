@@ -0,0 +1,238 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"api/pkg/imaging"
+	"api/pkg/storage"
+)
+
+// Largest image downloaded to make variants of a linked image
+const maxLinkedImageBytes = 20 << 20
+
+// ImageVariant is a resized copy of a property image
+type ImageVariant struct {
+	Name   string `json:"name"` // thumbnail, medium or large
+	URL    string `json:"url"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Key    string `json:"-"` // where the file is in storage
+}
+
+// ImageVariants are stored as JSON in a text column, including the storage
+// keys clients do not see
+type ImageVariants []ImageVariant
+
+type storedImageVariant struct {
+	Name   string `json:"name"`
+	URL    string `json:"url"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Key    string `json:"key"`
+}
+
+func (v ImageVariants) MarshalJSON() ([]byte, error) {
+	if v == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal([]ImageVariant(v))
+}
+
+func (v ImageVariants) Value() (driver.Value, error) {
+	if len(v) == 0 {
+		return nil, nil
+	}
+	stored := make([]storedImageVariant, len(v))
+	for i, variant := range v {
+		stored[i] = storedImageVariant(variant)
+	}
+	data, err := json.Marshal(stored)
+	return string(data), err
+}
+
+func (v *ImageVariants) Scan(value interface{}) error {
+	var data []byte
+	switch value := value.(type) {
+	case nil:
+		*v = nil
+		return nil
+	case []byte:
+		data = value
+	case string:
+		data = []byte(value)
+	default:
+		return fmt.Errorf("cannot scan %T into image variants", value)
+	}
+
+	var stored []storedImageVariant
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return err
+	}
+	*v = make(ImageVariants, len(stored))
+	for i, variant := range stored {
+		(*v)[i] = ImageVariant(variant)
+	}
+	return nil
+}
+
+// StoreUploadedImage removes location data from an uploaded JPEG, PNG, GIF
+// or WebP file, stores it together with resized variants of JPEGs and PNGs
+// and returns the image to add to the property
+func StoreUploadedImage(ctx context.Context, propertyID uint, contentType string, extension string, data []byte) (*PropertyImage, error) {
+	cleaned, err := imaging.StripLocation(contentType, data)
+	if err != nil {
+		return nil, err
+	}
+
+	var processed *imaging.Result
+	if contentType == "image/jpeg" || contentType == "image/png" {
+		if processed, err = imaging.Variants(contentType, cleaned); err != nil {
+			return nil, err
+		}
+	}
+
+	base, err := newImageKey(propertyID)
+	if err != nil {
+		return nil, err
+	}
+	key := base + extension
+	if err := storage.Default().Put(ctx, key, bytes.NewReader(cleaned), int64(len(cleaned)), contentType); err != nil {
+		return nil, err
+	}
+
+	size := int64(len(cleaned))
+	image := &PropertyImage{
+		URL:         storage.Default().URL(key),
+		StorageKey:  &key,
+		ContentType: &contentType,
+		Size:        &size,
+	}
+
+	if processed != nil {
+		variants, err := storeVariants(ctx, base, processed)
+		if err != nil {
+			deleteStorageKeys([]string{key})
+			return nil, err
+		}
+		image.Width, image.Height, image.Variants = &processed.Width, &processed.Height, variants
+	}
+	return image, nil
+}
+
+// storeVariants puts the variants of an image next to it in storage
+func storeVariants(ctx context.Context, base string, processed *imaging.Result) (ImageVariants, error) {
+	var variants ImageVariants
+	for _, variant := range processed.Variants {
+		key := base + "-" + variant.Name + variant.Extension
+		if err := storage.Default().Put(ctx, key, bytes.NewReader(variant.Data), int64(len(variant.Data)), variant.ContentType); err != nil {
+			deleteImageFiles([]PropertyImage{{Variants: variants}})
+			return nil, err
+		}
+		variants = append(variants, ImageVariant{
+			Name:   variant.Name,
+			URL:    storage.Default().URL(key),
+			Width:  variant.Width,
+			Height: variant.Height,
+			Key:    key,
+		})
+	}
+	return variants, nil
+}
+
+// Linked images are downloaded by a fixed number of workers from a bounded
+// queue, so a burst of saves cannot start unbounded downloads
+const (
+	linkedImageWorkers   = 4
+	linkedImageQueueSize = 500
+)
+
+var (
+	linkedImageQueue     chan PropertyImage
+	linkedImageQueueOnce sync.Once
+)
+
+// linkedImages returns the images that were added by URL and have no
+// files of their own yet
+func linkedImages(images []PropertyImage) []PropertyImage {
+	var linked []PropertyImage
+	for _, image := range images {
+		if image.StorageKey == nil && len(image.Variants) == 0 {
+			linked = append(linked, image)
+		}
+	}
+	return linked
+}
+
+// ProcessLinkedImages queues the images the last save of the property added
+// by URL, to be downloaded and stored as resized variants in the background.
+// Callers only do this for trusted users, since it makes the server fetch
+// the URLs. An image that cannot be fetched or decoded, or does not fit in
+// the queue, just goes without variants.
+func (p *Property) ProcessLinkedImages() {
+	linkedImageQueueOnce.Do(func() {
+		linkedImageQueue = make(chan PropertyImage, linkedImageQueueSize)
+		for i := 0; i < linkedImageWorkers; i++ {
+			go processLinkedImages()
+		}
+	})
+
+	for _, image := range p.linkedImages {
+		select {
+		case linkedImageQueue <- image:
+		default:
+			fmt.Printf("image queue is full, no variants for image %d (%s)\n", image.ID, image.URL)
+		}
+	}
+	p.linkedImages = nil
+}
+
+// processLinkedImages is a worker of the linked image queue
+func processLinkedImages() {
+	for image := range linkedImageQueue {
+		if err := processLinkedImage(image); err != nil {
+			fmt.Printf("no variants for image %d (%s): %v\n", image.ID, image.URL, err)
+		}
+	}
+}
+
+func processLinkedImage(image PropertyImage) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	data, err := imaging.Fetch(ctx, image.URL, maxLinkedImageBytes)
+	if err != nil {
+		return err
+	}
+	processed, err := imaging.Variants(http.DetectContentType(data), data)
+	if err != nil {
+		return err
+	}
+
+	base, err := newImageKey(image.PropertyID)
+	if err != nil {
+		return err
+	}
+	variants, err := storeVariants(ctx, base, processed)
+	if err != nil {
+		return err
+	}
+
+	result := db.Model(&PropertyImage{}).Where("id = ?", image.ID).Updates(map[string]interface{}{
+		"width":    processed.Width,
+		"height":   processed.Height,
+		"variants": variants,
+	})
+	if result.Error != nil || result.RowsAffected == 0 {
+		// Removed while we were working on it
+		deleteImageFiles([]PropertyImage{{Variants: variants}})
+		return result.Error
+	}
+	return nil
+}
@@ -0,0 +1,370 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"api/pkg/storage"
+
+	"gorm.io/gorm"
+)
+
+// Most photos a property can carry
+const MaxPropertyImages = 100
+
+var (
+	ErrImageNotFound     = errors.New("image not found")
+	ErrInvalidImageOrder = errors.New("image_ids must list every image of the property once")
+)
+
+// PropertyImage is one photo of a property. Images are ordered by Position,
+// which follows their order in the property's images array, and exactly
+// one of them is the cover. Uploaded images carry the key of their file in
+// storage; images added by URL are hosted elsewhere.
+type PropertyImage struct {
+	ID          uint      `json:"id" gorm:"primarykey"`
+	CreatedAt   time.Time `json:"-"`
+	UpdatedAt   time.Time `json:"-"`
+	PropertyID  uint      `json:"-" gorm:"index;not null"`
+	URL         string    `json:"url" gorm:"type:varchar(2048);not null"`
+	Position    int       `json:"position" gorm:"not null;default:0"`
+	Cover       bool      `json:"cover" gorm:"not null;default:false"`
+	Caption     *string   `json:"caption" gorm:"type:varchar(255)"`
+	StorageKey  *string   `json:"-" gorm:"type:varchar(512)"`
+	ContentType *string   `json:"content_type,omitempty" gorm:"type:varchar(64)"` // uploads only
+	Size        *int64    `json:"size,omitempty"`                                 // bytes, uploads only
+
+	// Upright pixel size and resized copies, once the image has been processed
+	Width    *int          `json:"width"`
+	Height   *int          `json:"height"`
+	Variants ImageVariants `json:"variants" gorm:"type:text"`
+	Srcset   string        `json:"srcset" gorm:"-"` // output only, see MarshalJSON
+}
+
+// MarshalJSON adds the srcset attribute value listing the image's variants
+// and the original by width
+func (i PropertyImage) MarshalJSON() ([]byte, error) {
+	i.Srcset = i.srcset()
+	type image PropertyImage
+	return json.Marshal(image(i))
+}
+
+func (i *PropertyImage) srcset() string {
+	if len(i.Variants) == 0 && i.Width == nil {
+		return i.URL
+	}
+
+	var candidates []string
+	for _, variant := range i.Variants {
+		candidates = append(candidates, fmt.Sprintf("%s %dw", variant.URL, variant.Width))
+	}
+	if i.Width != nil {
+		candidates = append(candidates, fmt.Sprintf("%s %dw", i.URL, *i.Width))
+	}
+	return strings.Join(candidates, ", ")
+}
+
+// UnmarshalJSON also accepts a bare URL string for an image
+func (i *PropertyImage) UnmarshalJSON(data []byte) error {
+	var imageURL string
+	if json.Unmarshal(data, &imageURL) == nil {
+		*i = PropertyImage{URL: imageURL}
+		return nil
+	}
+
+	type image PropertyImage
+	return json.Unmarshal(data, (*image)(i))
+}
+
+// PropertyImages is the images array of a property. Besides an array of
+// image objects or URLs it accepts the legacy string of delimited URLs.
+type PropertyImages []PropertyImage
+
+func (images PropertyImages) MarshalJSON() ([]byte, error) {
+	if images == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal([]PropertyImage(images))
+}
+
+func (images *PropertyImages) UnmarshalJSON(data []byte) error {
+	var delimited string
+	if json.Unmarshal(data, &delimited) == nil {
+		*images = nil
+		for _, imageURL := range splitImageURLs(delimited) {
+			*images = append(*images, PropertyImage{URL: imageURL})
+		}
+		return nil
+	}
+
+	var list []PropertyImage
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*images = list
+	return nil
+}
+
+// splitImageURLs pulls the http(s) URLs out of a string of URLs separated
+// by commas, semicolons, pipes or whitespace, dropping duplicates
+func splitImageURLs(s string) []string {
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ';' || r == '|' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	})
+
+	var urls []string
+	seen := map[string]bool{}
+	for _, field := range fields {
+		field = strings.Trim(field, `"'[]`)
+		if !validImageURL(field) || seen[field] {
+			continue
+		}
+		seen[field] = true
+		urls = append(urls, field)
+	}
+	return urls
+}
+
+func validImageURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// newImageKey returns a fresh storage key, without extension, for an
+// image of the property
+func newImageKey(propertyID uint) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%sproperties/%d/%s", storage.PublicPrefix, propertyID, hex.EncodeToString(b)), nil
+}
+
+func withImages(query *gorm.DB) *gorm.DB {
+	return query.Preload("Images", func(tx *gorm.DB) *gorm.DB {
+		return tx.Order("position, id")
+	})
+}
+
+func (p *Property) validateImages() error {
+	if len(p.Images) > MaxPropertyImages {
+		return fmt.Errorf("a property can have at most %d images", MaxPropertyImages)
+	}
+
+	seen := map[string]bool{}
+	for _, image := range p.Images {
+		if !validImageURL(image.URL) {
+			return fmt.Errorf("images must be http or https URLs")
+		}
+		if seen[image.URL] {
+			return fmt.Errorf("image %s is listed twice", image.URL)
+		}
+		seen[image.URL] = true
+		if image.Caption != nil && len(*image.Caption) > 255 {
+			return fmt.Errorf("image captions must be at most 255 characters")
+		}
+	}
+	return nil
+}
+
+// normalizeImages numbers the images in array order and makes sure exactly
+// one is the cover, the first one unless another is chosen
+func (p *Property) normalizeImages() {
+	if p.Images == nil {
+		p.Images = PropertyImages{}
+	}
+
+	cover := -1
+	for i := range p.Images {
+		p.Images[i].Position = i
+		if p.Images[i].Cover && cover == -1 {
+			cover = i
+		}
+		p.Images[i].Cover = false
+	}
+	if cover == -1 {
+		cover = 0
+	}
+	if len(p.Images) > 0 {
+		p.Images[cover].Cover = true
+	}
+}
+
+// forgetFiles clears what a client may not claim about an image added by
+// URL: it has no stored file or variants until it has been processed
+func (i *PropertyImage) forgetFiles() {
+	i.ID = 0
+	i.StorageKey = nil
+	i.ContentType = nil
+	i.Size = nil
+	i.Width = nil
+	i.Height = nil
+	i.Variants = nil
+}
+
+// prepareImages readies the images of a new property, which are all
+// external URLs
+func (p *Property) prepareImages() {
+	for i := range p.Images {
+		p.Images[i].forgetFiles()
+	}
+	p.normalizeImages()
+}
+
+// syncImages makes the stored images of the property match p.Images and
+// returns the images it added and removed. Images are matched by URL, so
+// unchanged photos keep their IDs and files.
+func (p *Property) syncImages(tx *gorm.DB) (created []PropertyImage, removed []PropertyImage, err error) {
+	var stored []PropertyImage
+	if err := tx.Where("property_id = ?", p.ID).Find(&stored).Error; err != nil {
+		return nil, nil, err
+	}
+	byURL := map[string]PropertyImage{}
+	for _, image := range stored {
+		byURL[image.URL] = image
+	}
+
+	p.normalizeImages()
+
+	var kept []uint
+	for i := range p.Images {
+		image := &p.Images[i]
+		image.PropertyID = p.ID
+
+		if existing, ok := byURL[image.URL]; ok {
+			delete(byURL, image.URL)
+			image.ID = existing.ID
+			image.CreatedAt = existing.CreatedAt
+			image.StorageKey = existing.StorageKey
+			image.ContentType = existing.ContentType
+			image.Size = existing.Size
+			image.Width = existing.Width
+			image.Height = existing.Height
+			image.Variants = existing.Variants
+			kept = append(kept, image.ID)
+			if err := tx.Model(image).Select("position", "cover", "caption").Updates(image).Error; err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+
+		// Only uploads arrive with a file, the rest are links
+		if image.StorageKey == nil {
+			image.forgetFiles()
+		}
+		image.ID = 0
+		if err := tx.Create(image).Error; err != nil {
+			return nil, nil, err
+		}
+		kept = append(kept, image.ID)
+		created = append(created, *image)
+	}
+
+	for _, image := range byURL {
+		removed = append(removed, image)
+	}
+
+	query := tx.Where("property_id = ?", p.ID)
+	if len(kept) > 0 {
+		query = query.Where("id NOT IN ?", kept)
+	}
+	if err := query.Delete(&PropertyImage{}).Error; err != nil {
+		return nil, nil, err
+	}
+	return created, removed, nil
+}
+
+// deleteImageFiles removes the uploaded files and the variants of images
+// from storage. Failures are only logged: the rows are gone already and a
+// stray file does no harm.
+func deleteImageFiles(images []PropertyImage) {
+	var keys []string
+	for _, image := range images {
+		if image.StorageKey != nil {
+			keys = append(keys, *image.StorageKey)
+		}
+		for _, variant := range image.Variants {
+			keys = append(keys, variant.Key)
+		}
+	}
+	deleteStorageKeys(keys)
+}
+
+func deleteStorageKeys(keys []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	for _, key := range keys {
+		if err := storage.Default().Delete(ctx, key); err != nil {
+			fmt.Printf("failed to delete file %s: %v\n", key, err)
+		}
+	}
+}
+
+func (p *Property) imageIndex(imageID uint) int {
+	for i, image := range p.Images {
+		if image.ID == imageID {
+			return i
+		}
+	}
+	return -1
+}
+
+// AddImages appends images to the property and saves it
+func (p *Property) AddImages(images []PropertyImage) error {
+	if len(p.Images)+len(images) > MaxPropertyImages {
+		return fmt.Errorf("a property can have at most %d images", MaxPropertyImages)
+	}
+	p.Images = append(p.Images, images...)
+	return p.SaveVersioned()
+}
+
+// SetCoverImage makes the image the cover of the property and saves it
+func (p *Property) SetCoverImage(imageID uint) error {
+	index := p.imageIndex(imageID)
+	if index == -1 {
+		return ErrImageNotFound
+	}
+	for i := range p.Images {
+		p.Images[i].Cover = i == index
+	}
+	return p.SaveVersioned()
+}
+
+// ReorderImages puts the images in the order of imageIDs, which must list
+// every image of the property once, and saves the property
+func (p *Property) ReorderImages(imageIDs []uint) error {
+	if len(imageIDs) != len(p.Images) {
+		return ErrInvalidImageOrder
+	}
+
+	ordered := make(PropertyImages, 0, len(imageIDs))
+	seen := map[uint]bool{}
+	for _, imageID := range imageIDs {
+		index := p.imageIndex(imageID)
+		if index == -1 || seen[imageID] {
+			return ErrInvalidImageOrder
+		}
+		seen[imageID] = true
+		ordered = append(ordered, p.Images[index])
+	}
+	p.Images = ordered
+	return p.SaveVersioned()
+}
+
+// RemoveImage deletes the image, and its file if it was uploaded, and
+// saves the property. The first image becomes the cover if it was the cover.
+func (p *Property) RemoveImage(imageID uint) error {
+	index := p.imageIndex(imageID)
+	if index == -1 {
+		return ErrImageNotFound
+	}
+	p.Images = append(p.Images[:index:index], p.Images[index+1:]...)
+	return p.SaveVersioned()
+}
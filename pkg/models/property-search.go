@@ -0,0 +1,268 @@
+package models
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const propertySearchIndex = "idx_properties_search"
+
+// Columns covered by the FULLTEXT index, in index order
+var propertySearchColumns = []string{
+	"address",
+	"description",
+	"zoning",
+	"property_type",
+	"deal_holder",
+	"price_break_down",
+	"additional_benefits",
+}
+
+// InnoDB ignores words shorter than innodb_ft_min_token_size (3 by default)
+const minSearchTermLength = 3
+
+// Length of the text kept on either side of a match in a snippet
+const snippetContext = 60
+
+// SearchHighlight is a snippet of a property field that matched the search,
+// with the matches wrapped in <mark> tags. Text outside the tags is HTML
+// escaped so snippets can be rendered as-is.
+type SearchHighlight struct {
+	Field   string `json:"field"`
+	Snippet string `json:"snippet"`
+}
+
+// SearchQuery is a parsed search string. Bare words are terms, "quoted
+// text" is a phrase; a property must match every term and phrase.
+type SearchQuery struct {
+	Terms   []string
+	Phrases []string
+}
+
+// ParseSearchQuery splits a raw search string into terms and phrases
+func ParseSearchQuery(raw string) SearchQuery {
+	var q SearchQuery
+
+	parts := strings.Split(raw, `"`)
+	for i, part := range parts {
+		// Odd segments sit between a pair of quotes
+		if i%2 == 1 && i < len(parts)-1 {
+			if phrase := strings.Join(strings.Fields(cleanSearchText(part)), " "); phrase != "" {
+				q.Phrases = append(q.Phrases, phrase)
+			}
+			continue
+		}
+		for _, term := range strings.Fields(cleanSearchText(part)) {
+			q.Terms = append(q.Terms, term)
+		}
+	}
+
+	return q
+}
+
+// cleanSearchText lower-cases s and turns punctuation into spaces. The
+// full-text parser splits words on punctuation anyway, and this keeps
+// boolean mode operators (+ - < > ( ) ~ * " @) out of the expression.
+func cleanSearchText(s string) string {
+	return strings.Map(func(r rune) rune {
+		if !unicode.IsLetter(r) && !unicode.IsNumber(r) {
+			return ' '
+		}
+		return r
+	}, strings.ToLower(s))
+}
+
+// IsEmpty reports whether the query has nothing to search for
+func (q SearchQuery) IsEmpty() bool {
+	return len(q.Terms) == 0 && len(q.Phrases) == 0
+}
+
+// booleanExpression renders the query for MATCH ... AGAINST in boolean mode.
+// Every term is required and matched as a prefix so partially typed words
+// still hit. Terms too short for the full-text index are returned separately.
+func (q SearchQuery) booleanExpression() (string, []string) {
+	var parts, short []string
+
+	for _, term := range q.Terms {
+		if utf8.RuneCountInString(term) < minSearchTermLength {
+			short = append(short, term)
+			continue
+		}
+		parts = append(parts, "+"+term+"*")
+	}
+	for _, phrase := range q.Phrases {
+		parts = append(parts, `+"`+phrase+`"`)
+	}
+
+	return strings.Join(parts, " "), short
+}
+
+// Highlights returns a snippet for every searchable field of p that
+// contains one of the query's terms or phrases
+func (q SearchQuery) Highlights(p *Property) []SearchHighlight {
+	fields := []struct {
+		name  string
+		value *string
+	}{
+		{"address", &p.Address},
+		{"description", p.Description},
+		{"zoning", p.Zoning},
+		{"property_type", p.PropertyType},
+		{"deal_holder", p.DealHolder},
+		{"price_breakdown", p.PriceBreakDown},
+		{"additional_benefits", p.AdditionalBenefits},
+	}
+
+	needles := append(append([]string{}, q.Phrases...), q.Terms...)
+
+	var highlights []SearchHighlight
+	for _, field := range fields {
+		if field.value == nil || *field.value == "" {
+			continue
+		}
+		if snippet, ok := highlightSnippet(*field.value, needles); ok {
+			highlights = append(highlights, SearchHighlight{Field: field.name, Snippet: snippet})
+		}
+	}
+
+	return highlights
+}
+
+// highlightSnippet cuts a window of text around the first match of any
+// needle and marks every match inside that window
+func highlightSnippet(text string, needles []string) (string, bool) {
+	lower := strings.ToLower(text)
+
+	// Lower-casing can change byte lengths for some scripts, in which case
+	// offsets into lower are not valid for text
+	if len(lower) != len(text) {
+		return "", false
+	}
+
+	first := -1
+	for _, needle := range needles {
+		if i := strings.Index(lower, needle); i >= 0 && (first < 0 || i < first) {
+			first = i
+		}
+	}
+	if first < 0 {
+		return "", false
+	}
+
+	start := first - snippetContext
+	if start < 0 {
+		start = 0
+	}
+	end := first + snippetContext*2
+	if end > len(text) {
+		end = len(text)
+	}
+	// Do not cut through a multi-byte character
+	for start > 0 && !utf8.RuneStart(text[start]) {
+		start--
+	}
+	for end < len(text) && !utf8.RuneStart(text[end]) {
+		end++
+	}
+
+	window, lowerWindow := text[start:end], lower[start:end]
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	for pos := 0; pos < len(window); {
+		matched := 0
+		for _, needle := range needles {
+			if strings.HasPrefix(lowerWindow[pos:], needle) && len(needle) > matched {
+				matched = len(needle)
+			}
+		}
+		if matched == 0 {
+			_, size := utf8.DecodeRuneInString(window[pos:])
+			b.WriteString(html.EscapeString(window[pos : pos+size]))
+			pos += size
+			continue
+		}
+		b.WriteString("<mark>" + html.EscapeString(window[pos:pos+matched]) + "</mark>")
+		pos += matched
+	}
+	if end < len(text) {
+		b.WriteString("…")
+	}
+
+	return b.String(), true
+}
+
+// migratePropertySearchIndex creates the FULLTEXT index used by
+// SearchProperties. AutoMigrate cannot express FULLTEXT indexes, so this
+// runs as a one-off statement when the index is missing.
+func migratePropertySearchIndex() {
+	if db.Migrator().HasIndex(&Property{}, propertySearchIndex) {
+		return
+	}
+
+	statement := fmt.Sprintf("CREATE FULLTEXT INDEX %s ON properties (%s)",
+		propertySearchIndex, strings.Join(propertySearchColumns, ", "))
+	if err := db.Exec(statement).Error; err != nil {
+		fmt.Println("failed to create full-text search index:", err)
+	}
+}
+
+// SearchProperties returns properties matching every term and phrase of
+// query, ranked by relevance unless the filter asks for another sort. Each
+// result carries its relevance score and highlighted snippets.
+func SearchProperties(query string, limit int, offset int, filter *PropertyFilter) ([]Property, int64) {
+	var properties []Property
+	var total int64
+
+	search := ParseSearchQuery(query)
+	if search.IsEmpty() {
+		// Nothing to rank by, fall back to the default listing order
+		if filter != nil && filter.Sort == "relevance" {
+			listing := *filter
+			listing.Sort, listing.Order = "created_at", "desc"
+			filter = &listing
+		}
+		return GetPaginatedProperties(limit, offset, filter)
+	}
+
+	// Prepare the base query with the structured filters applied
+	dbQuery := filter.Where(db.Model(&Property{}))
+
+	expression, shortTerms := search.booleanExpression()
+	match := "MATCH(" + strings.Join(propertySearchColumns, ", ") + ") AGAINST(? IN BOOLEAN MODE)"
+
+	if expression != "" {
+		dbQuery = dbQuery.Where(match, expression)
+	}
+
+	// Words below the index's minimum token size fall back to a substring
+	// match on the address, which is where short tokens (unit numbers,
+	// state codes) usually appear
+	for _, term := range shortTerms {
+		dbQuery = dbQuery.Where("LOWER(address) LIKE ?", "%"+term+"%")
+	}
+
+	// Get total count
+	dbQuery.Count(&total)
+
+	columns, args := filter.Columns()
+	if expression != "" {
+		dbQuery = dbQuery.Select(columns+", "+match+" AS relevance", append(args, expression)...)
+	} else {
+		dbQuery = dbQuery.Select(columns+", 0 AS relevance", args...)
+	}
+
+	// Get paginated results
+	withImages(dbQuery).Order(filter.OrderClause()).Limit(limit).Offset(offset).Find(&properties)
+
+	for i := range properties {
+		properties[i].Highlights = search.Highlights(&properties[i])
+	}
+
+	return properties, total
+}
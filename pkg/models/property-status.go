@@ -0,0 +1,48 @@
+package models
+
+// Listing status of a property. Accepting an offer puts the property under
+// contract and closing that offer sells it; see offer.go.
+const (
+	PropertyAvailable     = "available"
+	PropertyUnderContract = "under_contract"
+	PropertySold          = "sold"
+)
+
+var propertyStatuses = []string{PropertyAvailable, PropertyUnderContract, PropertySold}
+
+// ReconcileStatus keeps Status and the older Sold flag in agreement after a
+// client wrote the property. previous is the property before the write, nil
+// for a new one. A changed status wins; otherwise a changed sold flag marks
+// the property sold, or available again.
+func (p *Property) ReconcileStatus(previous *Property) {
+	sold := p.Sold != nil && *p.Sold
+
+	if previous == nil {
+		if p.Status == "" {
+			p.Status = PropertyAvailable
+			if sold {
+				p.Status = PropertySold
+			}
+		}
+	} else {
+		if p.Status == "" {
+			p.Status = previous.Status
+		}
+		wasSold := previous.Sold != nil && *previous.Sold
+		if p.Status == previous.Status && sold != wasSold {
+			if sold {
+				p.Status = PropertySold
+			} else if p.Status == PropertySold {
+				p.Status = PropertyAvailable
+			}
+		}
+	}
+
+	p.Sold = newBool(p.Status == PropertySold)
+}
+
+// migratePropertyStatus gives properties that were marked sold before the
+// status column existed the sold status; the rest default to available
+func migratePropertyStatus() error {
+	return db.Model(&Property{}).Where("sold = ?", true).UpdateColumn("status", PropertySold).Error
+}
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrVersionConflict = errors.New("property was modified by another request")
+
+// ETag returns the entity tag of the property's current version
+func (p *Property) ETag() string {
+	return fmt.Sprintf(`"%d-%d"`, p.ID, p.Version)
+}
+
+// MatchesETag reports whether an If-Match header value names the property's
+// current version. If-Match uses the strong comparison of RFC 7232, so weak
+// tags never match. "*" matches any version.
+func (p *Property) MatchesETag(header string) bool {
+	current := p.ETag()
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || tag == current {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchesETagWeak reports whether an If-None-Match header value names the
+// property's current version, using the weak comparison of RFC 7232 that
+// ignores the W/ prefix. "*" matches any version.
+func (p *Property) MatchesETagWeak(header string) bool {
+	current := p.ETag()
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == current {
+			return true
+		}
+	}
+	return false
+}
+
+// SaveVersioned writes every column and the images of the property,
+// provided nobody else has saved it since it was loaded, and bumps its
+// version. It returns ErrVersionConflict when the stored version has moved on.
+// Images it adds by URL are left for ProcessLinkedImages.
+func (p *Property) SaveVersioned() error {
+	expected := p.Version
+	p.Version = expected + 1
+
+	var created, removed []PropertyImage
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(p).Where("version = ?", expected).
+			Select("*").Omit("id", "created_at", "deleted_at", clause.Associations).
+			Updates(p)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrVersionConflict
+		}
+		var err error
+		created, removed, err = p.syncImages(tx)
+		return err
+	})
+	if err != nil {
+		p.Version = expected
+		return err
+	}
+
+	deleteImageFiles(removed)
+	p.linkedImages = linkedImages(created)
+	return nil
+}
+
+// DeleteVersioned soft deletes the property if it is still at the version
+// it was loaded with
+func (p *Property) DeleteVersioned() error {
+	result := db.Where("id = ? AND version = ?", p.ID, p.Version).Delete(&Property{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrVersionConflict
+	}
+	return nil
+}
@@ -1,9 +1,11 @@
 package models
 
 import (
-	"strings"
+	"fmt"
+	"time"
 
 	"api/pkg/config"
+	"api/pkg/finance"
 
 	"gorm.io/gorm"
 )
@@ -12,53 +14,75 @@ var db *gorm.DB
 
 type Property struct {
 	gorm.Model
-	Address                string   `json:"address"`
-	Price                  *float64 `json:"price"`                    // DECIMAL(10, 2)
-	Description            *string  `json:"description"`              // TEXT
-	Images                 *string  `json:"images"`                   // JSON array of image URLs or a string of delimited URLs
-	Sold                   *bool    `json:"sold"`                     // BOOLEAN
-	Bedrooms               *int     `json:"bedrooms"`                 // INT
-	Bathrooms              *float64 `json:"bathrooms"`                // DECIMAL(3, 1)
-	RentZestimate          *float64 `json:"rent_zestimate"`           // DECIMAL(10, 2)
-	Zestimate              *float64 `json:"zestimate"`                // DECIMAL(10, 2)
-	PropertyType           *string  `json:"property_type"`            // VARCHAR(255)
-	Zoning                 *string  `json:"zoning"`                   // VARCHAR(255)
-	YearBuilt              *int     `json:"year_built"`               // INT
-	LotSize                *int     `json:"lot_size"`                 // INT
-	PricePerSquareFoot     *float64 `json:"price_per_square_foot"`    // DECIMAL(10, 2)
-	LivingArea             *int     `json:"living_area"`              // INT
-	PurchasePrice          *float64 `json:"purchase_price"`           // DECIMAL(10,2)
-	BalanceToClose         *float64 `json:"balance_to_close"`         // DECIMAL(10,2)
-	MonthlyHoldingCost     *float64 `json:"monthly_holding_cost"`     // DECIMAL(10,2)
-	InterestRate           *float64 `json:"interest_rate"`            // DECIMAL(10,2)
-	NearbyHospitals        *string  `json:"nearby_hospitals"`         // JSON array of nearby_hospitals
-	NearbySchools          *string  `json:"nearby_schools"`           // JSON array of nearby_schools
-	NearbyHomes            *string  `json:"nearby_homes"`             // JSON array of nearby_homes
-	PriceHistory           *string  `json:"price_history"`            // JSON array of price history
-	TaxHistory             *string  `json:"tax_history"`              // JSON array of tax history
-	ContactRecipients      *string  `json:"contact_recipients"`       // JSON array of contact_recipients
-	MonthlyHoaFee          *int     `json:"monthly_hoa_fee"`          // INT
-	TransactionDocumentUrl string   `json:"transaction_document_url"` // string url of transaction document
-	BenefitSheetUrl        string   `json:"benefit_sheet_url"`
-	DocsUrl                string   `json:"docs_url"`
-	Escrow                 *float64 `json:"escrow"` // DECIMAL(10, 2)
-	DealHolder             *string  `json:"deal_holder"`
-	DealHolderPhone        *string  `json:"deal_holder_phone"`
-	DealHolderEmail        *string  `json:"deal_holder_email"`
-	AssignmentFee          *float64 `json:"assignment_fee"`
-	InHouseDeal            *bool    `json:"in_house_deal"`       // BOOLEAN
-	RentalRestriction      *bool    `json:"rental_restriction"`  // BOOLEAN
-	PriceBreakDown         *string  `json:"price_breakdown"`     // VARCHAR(255)
-	AdditionalBenefits     *string  `json:"additional_benefits"` // VARCHAR(255)
-	CreatedBy              *string  `json:"created_by"`          // VARCHAR(255) - can be "user" or "admin"
-	ReApiId                *string  `json:"re_api_id"`           // VARCHAR(255) - Real Estate API ID
+	Address            string                     `json:"address"`
+	Price              *float64                   `json:"price"`                                                           // DECIMAL(10, 2)
+	Description        *string                    `json:"description"`                                                     // TEXT
+	Images             PropertyImages             `json:"images" gorm:"foreignKey:PropertyID;constraint:OnDelete:CASCADE"` // ordered photos, see property-details.go
+	Sold               *bool                      `json:"sold"`                                                            // BOOLEAN, mirrors Status
+	Status             string                     `json:"status" gorm:"type:varchar(16);not null;default:available;index"` // see ReconcileStatus
+	Bedrooms           *int                       `json:"bedrooms"`                                                        // INT
+	Bathrooms          *float64                   `json:"bathrooms"`                                                       // DECIMAL(3, 1)
+	RentZestimate      *float64                   `json:"rent_zestimate"`                                                  // DECIMAL(10, 2)
+	Zestimate          *float64                   `json:"zestimate"`                                                       // DECIMAL(10, 2)
+	PropertyType       *string                    `json:"property_type"`                                                   // VARCHAR(255)
+	Zoning             *string                    `json:"zoning"`                                                          // VARCHAR(255)
+	YearBuilt          *int                       `json:"year_built"`                                                      // INT
+	LotSize            *int                       `json:"lot_size"`                                                        // INT
+	PricePerSquareFoot *float64                   `json:"price_per_square_foot"`                                           // DECIMAL(10, 2)
+	LivingArea         *int                       `json:"living_area"`                                                     // INT
+	PurchasePrice      *float64                   `json:"purchase_price"`                                                  // DECIMAL(10,2)
+	BalanceToClose     *float64                   `json:"balance_to_close"`                                                // DECIMAL(10,2)
+	MonthlyHoldingCost *float64                   `json:"monthly_holding_cost"`                                            // DECIMAL(10,2)
+	InterestRate       *float64                   `json:"interest_rate"`                                                   // DECIMAL(10,2)
+	NearbyHospitals    JSONList[NearbyPlace]      `json:"nearby_hospitals" gorm:"serializer:json"`                         // JSON text
+	NearbySchools      JSONList[NearbySchool]     `json:"nearby_schools" gorm:"serializer:json"`                           // JSON text
+	NearbyHomes        JSONList[NearbyHome]       `json:"nearby_homes" gorm:"serializer:json"`                             // JSON text
+	PriceHistory       JSONList[PriceEvent]       `json:"price_history" gorm:"serializer:json"`                            // JSON text
+	TaxHistory         JSONList[TaxRecord]        `json:"tax_history" gorm:"serializer:json"`                              // JSON text
+	ContactRecipients  JSONList[ContactRecipient] `json:"contact_recipients" gorm:"serializer:json"`                       // JSON text
+	MonthlyHoaFee      *int                       `json:"monthly_hoa_fee"`                                                 // INT
+	Escrow             *float64                   `json:"escrow"`                                                          // DECIMAL(10, 2)
+	DealHolder         *string                    `json:"deal_holder"`
+	DealHolderPhone    *string                    `json:"deal_holder_phone"`
+	DealHolderEmail    *string                    `json:"deal_holder_email"`
+	AssignmentFee      *float64                   `json:"assignment_fee"`
+	InHouseDeal        *bool                      `json:"in_house_deal"`                   // BOOLEAN
+	RentalRestriction  *bool                      `json:"rental_restriction"`              // BOOLEAN
+	PriceBreakDown     *string                    `json:"price_breakdown"`                 // VARCHAR(255)
+	AdditionalBenefits *string                    `json:"additional_benefits"`             // VARCHAR(255)
+	CreatedBy          *string                    `json:"created_by"`                      // VARCHAR(255) - can be "user" or "admin"
+	CreatedByUserID    *uint                      `json:"created_by_user_id" gorm:"index"` // User who submitted the property, if signed in
+	CreatedByUser      *User                      `json:"-" gorm:"foreignKey:CreatedByUserID;constraint:OnDelete:SET NULL"`
+	ReApiId            *string                    `json:"re_api_id"`                         // VARCHAR(255) - Real Estate API ID
+	Version            uint                       `json:"version" gorm:"not null;default:1"` // Bumped on every update, see SaveVersioned
+
+	// Structured address, derived from Address by NormalizeAddress
+	Street    *string  `json:"street" gorm:"type:varchar(255)"`
+	Unit      *string  `json:"unit" gorm:"type:varchar(64)"`
+	City      *string  `json:"city" gorm:"type:varchar(255);index"`
+	State     *string  `json:"state" gorm:"type:varchar(2);index"`
+	Zip       *string  `json:"zip" gorm:"type:varchar(10);index"`
+	County    *string  `json:"county" gorm:"type:varchar(255)"`
+	Latitude  *float64 `json:"latitude"` // indexed through the location column, see migratePropertyLocationIndex
+	Longitude *float64 `json:"longitude"`
+
+	// Search results only
+	Relevance  *float64          `json:"relevance,omitempty" gorm:"->;-:migration"`
+	Distance   *float64          `json:"distance,omitempty" gorm:"->;-:migration"` // miles from the near point
+	Highlights []SearchHighlight `json:"highlights,omitempty" gorm:"-"`
+
+	// Images linked by URL in the last save, see ProcessLinkedImages
+	linkedImages []PropertyImage
 }
 
 func init() {
-	config.Connect()
 	db = config.GetDB()
 
-	db.AutoMigrate(&Property{})
+	db.AutoMigrate(&Property{}, &PropertyImage{})
+	migratePropertySearchIndex()
+	migratePropertyLocationIndex()
+	runDataMigration("property_typed_details", migratePropertyDetails)
+	runDataMigration("property_status", migratePropertyStatus)
 
 	// DeleteProperty(8)
 
@@ -72,59 +96,37 @@ func init() {
 
 func GetAllProperties() []Property {
 	var Properties []Property
-	db.Find(&Properties)
+	withImages(db).Find(&Properties)
 	return Properties
 }
 
-func GetPaginatedProperties(limit int, offset int, sold *bool) ([]Property, int64) {
+func GetPaginatedProperties(limit int, offset int, filter *PropertyFilter) ([]Property, int64) {
 	var properties []Property
 	var total int64
 
-	query := db.Model(&Property{})
+	query := filter.Where(db.Model(&Property{}))
 
-	if sold != nil {
-		query = query.Where("sold = ?", *sold)
-	}
+	columns, args := filter.Columns()
 
 	query.Count(&total)
-	query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&properties)
-
-	return properties, total
-}
-
-func SearchProperties(query string, limit int, offset int, sold *bool) ([]Property, int64) {
-	var properties []Property
-	var total int64
-
-	// Prepare the base query
-	dbQuery := db.Model(&Property{})
-
-	// Apply sold filter if provided
-	if sold != nil {
-		dbQuery = dbQuery.Where("sold = ?", *sold)
-	}
-
-	// Search across address field
-	searchPattern := "%" + strings.ToLower(query) + "%"
-	dbQuery = dbQuery.Where("LOWER(address) LIKE ?", searchPattern)
-
-	// Get total count
-	dbQuery.Count(&total)
-
-	// Get paginated results
-	dbQuery.Order("created_at DESC").Limit(limit).Offset(offset).Find(&properties)
+	withImages(query.Select(columns, args...)).Order(filter.OrderClause()).Limit(limit).Offset(offset).Find(&properties)
 
 	return properties, total
 }
 
 func GetPropertyById(ID int64) (*Property, *gorm.DB) {
 	var getProperty Property
-	db := db.Where("ID=?", ID).Find(&getProperty)
+	db := withImages(db.Where("ID=?", ID)).Find(&getProperty)
 	return &getProperty, db
 }
 
 func (b *Property) CreateProperty() *Property {
-	db.Create(&b)
+	b.Version = 1
+	b.ReconcileStatus(nil)
+	b.prepareImages()
+	if db.Create(&b).Error == nil {
+		b.linkedImages = linkedImages(b.Images)
+	}
 	return b
 
 }
@@ -135,50 +137,140 @@ func DeleteProperty(ID int64) Property {
 	return property
 }
 
+// Validate checks the values a client can set on a property
+func (p *Property) Validate() error {
+	if p.CreatedBy != nil && *p.CreatedBy != "user" && *p.CreatedBy != "admin" {
+		return fmt.Errorf("CreatedBy must be either 'user' or 'admin'")
+	}
+	if p.Status != "" && !oneOf(propertyStatuses, p.Status) {
+		return fmt.Errorf("status must be one of %v", propertyStatuses)
+	}
+
+	nonNegative := map[string]*float64{
+		"price":                 p.Price,
+		"bathrooms":             p.Bathrooms,
+		"rent_zestimate":        p.RentZestimate,
+		"zestimate":             p.Zestimate,
+		"price_per_square_foot": p.PricePerSquareFoot,
+		"purchase_price":        p.PurchasePrice,
+		"balance_to_close":      p.BalanceToClose,
+		"monthly_holding_cost":  p.MonthlyHoldingCost,
+		"interest_rate":         p.InterestRate,
+		"escrow":                p.Escrow,
+		"assignment_fee":        p.AssignmentFee,
+	}
+	for field, value := range nonNegative {
+		if value != nil && *value < 0 {
+			return fmt.Errorf("%s must not be negative", field)
+		}
+	}
+
+	nonNegativeInts := map[string]*int{
+		"bedrooms":        p.Bedrooms,
+		"lot_size":        p.LotSize,
+		"living_area":     p.LivingArea,
+		"monthly_hoa_fee": p.MonthlyHoaFee,
+	}
+	for field, value := range nonNegativeInts {
+		if value != nil && *value < 0 {
+			return fmt.Errorf("%s must not be negative", field)
+		}
+	}
+
+	if p.YearBuilt != nil && (*p.YearBuilt < 1600 || *p.YearBuilt > time.Now().Year()+5) {
+		return fmt.Errorf("year_built is out of range")
+	}
+
+	if (p.Latitude == nil) != (p.Longitude == nil) {
+		return fmt.Errorf("latitude and longitude must be set together")
+	}
+	if p.Latitude != nil && !validLatitude(*p.Latitude) {
+		return fmt.Errorf("latitude is out of range")
+	}
+	if p.Longitude != nil && !validLongitude(*p.Longitude) {
+		return fmt.Errorf("longitude is out of range")
+	}
+
+	return p.validateDetails()
+}
+
 func SeedProperties() {
 	// Example set of properties to seed
 	properties := []Property{
 		{
-			Address:                "4949 Corrado Ave, Ave Maria, FL 34142",
-			Price:                  newFloat64(300000),
-			Description:            newString("Beautiful family home in a quiet neighborhood."),
-			Images:                 newString("[\"https://static.tildacdn.com/stor3630-6334-4663-b532-393032356238/65960768.jpg\", \"https://static.tildacdn.com/stor3663-3339-4534-b332-393563363363/61347039.jpg\"]"),
-			Sold:                   newBool(false),
-			Bedrooms:               newInt(3),
-			Bathrooms:              newFloat64(2.5),
-			RentZestimate:          newFloat64(2500),
-			Zestimate:              newFloat64(300000),
-			PropertyType:           newString("Single Family"),
-			Zoning:                 newString("R-1:SINGLE FAM-RES"),
-			YearBuilt:              newInt(1990),
-			LotSize:                newInt(5000),
-			LivingArea:             newInt(3000),
-			PricePerSquareFoot:     newFloat64(300),
-			PurchasePrice:          newFloat64(300000),
-			BalanceToClose:         newFloat64(10000),
-			MonthlyHoldingCost:     newFloat64(5000),
-			InterestRate:           newFloat64(300),
-			NearbyHospitals:        newString("[\"Hospital A\", \"Hospital B\"]"),
-			NearbySchools:          newString("[\"School A\", \"School B\"]"),
-			NearbyHomes:            newString("[\"Home A\", \"Home B\"]"),
-			PriceHistory:           newString("[{\"date\": \"2022-01-01\", \"price\": 295000}, {\"date\": \"2023-01-01\", \"price\": 300000}]"),
-			TaxHistory:             newString("[{\"year\": 2022, \"tax\": 3500}, {\"year\": 2023, \"tax\": 3600}]"),
-			ContactRecipients:      newString("[{\"agent_reason\":1,\"zpro\":null,\"recent_sales\":0,\"review_count\":8,\"display_name\":\"Elizabeth Jimenez\",\"zuid\":\"X1-ZU12a3ye9stjcw9_26nu5\",\"rating_average\":5,\"badge_type\":\"Premier Agent\",\"phone\":{\"prefix\":\"484\",\"areacode\":\"424\",\"number\":\"9901\"},\"image_url\":\"https://photos.zillowstatic.com/fp/a9702d055054a53bd296d7175519fb29-h_n.jpg\"}]"),
-			MonthlyHoaFee:          newInt(1000),
-			TransactionDocumentUrl: "https://docs.google.com/spreadsheets/d/1-Ot5O9Fh7mOVQa5SJieBGrU9rIaItGVyZmEXwz4aAJY/edit?gid=0#gid=0",
-			PriceBreakDown:         newString("This is the price breakdown"),
-			AdditionalBenefits:     newString("This is the additional benefits"),
-			CreatedBy:              newString("admin"),
-			ReApiId:                newString("4574363"),
+			Address:     "4949 Corrado Ave, Ave Maria, FL 34142",
+			Price:       newFloat64(300000),
+			Description: newString("Beautiful family home in a quiet neighborhood."),
+			Images: PropertyImages{
+				{URL: "https://static.tildacdn.com/stor3630-6334-4663-b532-393032356238/65960768.jpg"},
+				{URL: "https://static.tildacdn.com/stor3663-3339-4534-b332-393563363363/61347039.jpg"},
+			},
+			Sold:               newBool(false),
+			Bedrooms:           newInt(3),
+			Bathrooms:          newFloat64(2.5),
+			RentZestimate:      newFloat64(2500),
+			Zestimate:          newFloat64(300000),
+			PropertyType:       newString("Single Family"),
+			Zoning:             newString("R-1:SINGLE FAM-RES"),
+			YearBuilt:          newInt(1990),
+			LotSize:            newInt(5000),
+			LivingArea:         newInt(3000),
+			PricePerSquareFoot: newFloat64(300),
+			PurchasePrice:      newFloat64(300000),
+			BalanceToClose:     newFloat64(10000),
+			MonthlyHoldingCost: newFloat64(5000),
+			InterestRate:       newFloat64(300),
+			NearbyHospitals:    JSONList[NearbyPlace]{{Name: "Hospital A"}, {Name: "Hospital B"}},
+			NearbySchools:      JSONList[NearbySchool]{{Name: "School A"}, {Name: "School B"}},
+			NearbyHomes:        JSONList[NearbyHome]{{Address: "Home A"}, {Address: "Home B"}},
+			PriceHistory: JSONList[PriceEvent]{
+				{Date: seedDate("2022-01-01"), Price: newFloat64(295000)},
+				{Date: seedDate("2023-01-01"), Price: newFloat64(300000)},
+			},
+			TaxHistory: JSONList[TaxRecord]{
+				{Year: 2022, Tax: newFloat64(3500)},
+				{Year: 2023, Tax: newFloat64(3600)},
+			},
+			ContactRecipients: JSONList[ContactRecipient]{{
+				AgentReason:   newInt(1),
+				RecentSales:   newInt(0),
+				ReviewCount:   newInt(8),
+				DisplayName:   "Elizabeth Jimenez",
+				Zuid:          newString("X1-ZU12a3ye9stjcw9_26nu5"),
+				RatingAverage: newFloat64(5),
+				BadgeType:     newString("Premier Agent"),
+				Phone:         &ContactPhone{Prefix: "484", Areacode: "424", Number: "9901"},
+				ImageURL:      newString("https://photos.zillowstatic.com/fp/a9702d055054a53bd296d7175519fb29-h_n.jpg"),
+			}},
+			MonthlyHoaFee:      newInt(1000),
+			PriceBreakDown:     newString("This is the price breakdown"),
+			AdditionalBenefits: newString("This is the additional benefits"),
+			CreatedBy:          newString("admin"),
+			ReApiId:            newString("4574363"),
 		},
 	}
 
-	for _, property := range properties {
-		db.Create(&property)
+	for i := range properties {
+		properties[i].CreateProperty()
+		properties[i].ProcessLinkedImages()
 	}
+
+	transactionDocument := PropertyDocument{
+		PropertyID: properties[0].ID,
+		Type:       DocumentPurchaseContract,
+		Visibility: VisibilityNDA,
+		Name:       "Transaction document",
+		URL:        newString("https://docs.google.com/spreadsheets/d/1-Ot5O9Fh7mOVQa5SJieBGrU9rIaItGVyZmEXwz4aAJY/edit?gid=0#gid=0"),
+	}
+	transactionDocument.Save()
 }
 
 func newFloat64(v float64) *float64 { return &v }
 func newString(s string) *string    { return &s }
 func newInt(i int) *int             { return &i }
 func newBool(b bool) *bool          { return &b }
+
+func seedDate(s string) finance.Date {
+	date, _ := finance.ParseDate(s)
+	return date
+}
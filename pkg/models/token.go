@@ -0,0 +1,217 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"api/pkg/config"
+	"api/pkg/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token has already been used")
+)
+
+// RefreshToken is a server-side session. The client holds the plain token;
+// only its hash is stored. Each use rotates it: the old token is revoked
+// and replaced by a new one in the same family, so presenting a revoked
+// token again means it was stolen and the whole family is revoked.
+type RefreshToken struct {
+	gorm.Model
+	UserID       uint      `gorm:"index;not null"`
+	TokenHash    string    `gorm:"type:char(64);uniqueIndex;not null"`
+	FamilyID     string    `gorm:"type:varchar(64);index;not null"`
+	ExpiresAt    time.Time `gorm:"not null"`
+	RevokedAt    *time.Time
+	ReplacedByID *uint
+	TwoFactor    bool `gorm:"not null;default:false"` // the session was started with a second factor
+}
+
+// RevokedAccessToken is a deny-list entry for an access token (by jti) that
+// must stop working before it expires, e.g. after logout. Entries can be
+// dropped once the token would have expired anyway.
+type RevokedAccessToken struct {
+	JTI       string    `gorm:"primaryKey;type:varchar(64)"`
+	ExpiresAt time.Time `gorm:"index;not null"`
+}
+
+// UsedActionToken records an action token (password reset, email
+// verification) that has been redeemed, making those tokens single-use
+type UsedActionToken struct {
+	JTI       string    `gorm:"primaryKey;type:varchar(64)"`
+	ExpiresAt time.Time `gorm:"index;not null"`
+}
+
+var ErrActionTokenUsed = errors.New("token has already been used")
+
+func init() {
+	db = config.GetDB()
+	db.AutoMigrate(&RefreshToken{}, &RevokedAccessToken{}, &UsedActionToken{})
+}
+
+// CreateRefreshToken starts a new session for the user and returns the
+// plain token to hand to the client. twoFactor records whether the login
+// was confirmed with a second factor; it carries over to every rotation.
+func CreateRefreshToken(userID uint, twoFactor bool) (string, error) {
+	familyID, err := utils.GenerateRandomToken(16)
+	if err != nil {
+		return "", err
+	}
+	plain, _, err := createRefreshToken(db, userID, familyID, twoFactor)
+	return plain, err
+}
+
+func createRefreshToken(tx *gorm.DB, userID uint, familyID string, twoFactor bool) (string, *RefreshToken, error) {
+	plain, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+
+	token := RefreshToken{
+		UserID:    userID,
+		TokenHash: utils.HashToken(plain),
+		FamilyID:  familyID,
+		TwoFactor: twoFactor,
+		ExpiresAt: time.Now().Add(utils.RefreshTokenTTL),
+	}
+	if err := tx.Create(&token).Error; err != nil {
+		return "", nil, err
+	}
+
+	return plain, &token, nil
+}
+
+// RotateRefreshToken exchanges a refresh token for a new one and returns the
+// user it belongs to and whether the session was started with a second factor
+func RotateRefreshToken(plain string) (*User, string, bool, error) {
+	var user *User
+	var next string
+	var twoFactor bool
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var token RefreshToken
+		if err := tx.Where("token_hash = ?", utils.HashToken(plain)).First(&token).Error; err != nil {
+			return ErrInvalidRefreshToken
+		}
+
+		if token.RevokedAt != nil {
+			return ErrRefreshTokenReused
+		}
+
+		if time.Now().After(token.ExpiresAt) {
+			return ErrInvalidRefreshToken
+		}
+
+		var owner User
+		if err := tx.First(&owner, token.UserID).Error; err != nil || owner.IsDisabled() {
+			return ErrInvalidRefreshToken
+		}
+
+		plainNext, replacement, err := createRefreshToken(tx, token.UserID, token.FamilyID, token.TwoFactor)
+		if err != nil {
+			return err
+		}
+
+		// Guard on revoked_at so two concurrent refreshes cannot both win
+		result := tx.Model(&token).Where("revoked_at IS NULL").
+			Updates(map[string]interface{}{"revoked_at": time.Now(), "replaced_by_id": replacement.ID})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRefreshTokenReused
+		}
+
+		user, next, twoFactor = &owner, plainNext, token.TwoFactor
+		return nil
+	})
+	if err != nil {
+		// Reuse of a rotated token means someone else holds a copy of this
+		// session, so end it for everyone
+		if errors.Is(err, ErrRefreshTokenReused) {
+			revokeRefreshTokenFamily(plain)
+		}
+		return nil, "", false, err
+	}
+
+	return user, next, twoFactor, nil
+}
+
+func revokeRefreshTokenFamily(plain string) {
+	var token RefreshToken
+	if err := db.Where("token_hash = ?", utils.HashToken(plain)).First(&token).Error; err != nil {
+		return
+	}
+	db.Model(&RefreshToken{}).Where("family_id = ? AND revoked_at IS NULL", token.FamilyID).
+		Update("revoked_at", time.Now())
+}
+
+// RevokeRefreshToken ends the session a refresh token belongs to
+func RevokeRefreshToken(plain string) {
+	revokeRefreshTokenFamily(plain)
+}
+
+// RevokeUserTokens ends every session of the user and invalidates all access
+// tokens issued to them so far
+func RevokeUserTokens(userID uint) error {
+	// Recorded at the precision of token issue times, so every token issued
+	// up to now is caught while a login right after is not
+	now := time.Now().Truncate(utils.TokenTimePrecision)
+	if err := db.Model(&RefreshToken{}).Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", now).Error; err != nil {
+		return err
+	}
+	return db.Model(&User{}).Where("id = ?", userID).Update("tokens_revoked_at", now).Error
+}
+
+// RevokeAccessToken deny-lists a single access token until it expires
+func RevokeAccessToken(jti string, expiresAt time.Time) error {
+	if jti == "" {
+		return nil
+	}
+
+	// Housekeeping: entries for expired tokens are no longer needed
+	db.Where("expires_at < ?", time.Now()).Delete(&RevokedAccessToken{})
+
+	return db.Save(&RevokedAccessToken{JTI: jti, ExpiresAt: expiresAt}).Error
+}
+
+// IsAccessTokenRevoked reports whether an access token was revoked, either
+// individually or by revoking every token of its user at or after the moment
+// it was issued
+func IsAccessTokenRevoked(jti string, userID uint, issuedAt time.Time) bool {
+	var count int64
+	if jti != "" {
+		db.Model(&RevokedAccessToken{}).Where("jti = ?", jti).Count(&count)
+		if count > 0 {
+			return true
+		}
+	}
+
+	// Tokens of closed (deleted) accounts are revoked as well
+	db.Unscoped().Model(&User{}).
+		Where("id = ? AND (deleted_at IS NOT NULL OR (tokens_revoked_at IS NOT NULL AND tokens_revoked_at >= ?))", userID, issuedAt).
+		Count(&count)
+	return count > 0
+}
+
+// ConsumeActionToken marks an action token as used. The primary key makes
+// this atomic: of two concurrent redemptions only one succeeds, and the
+// other gets ErrActionTokenUsed.
+func ConsumeActionToken(jti string, expiresAt time.Time) error {
+	// Housekeeping: expired tokens are rejected on their own
+	db.Where("expires_at < ?", time.Now()).Delete(&UsedActionToken{})
+
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&UsedActionToken{JTI: jti, ExpiresAt: expiresAt})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrActionTokenUsed
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"api/pkg/config"
+	"api/pkg/utils"
+
+	"gorm.io/gorm"
+)
+
+// Issuer shown next to the account in authenticator apps
+const TwoFactorIssuer = "MyCreativeFinancing"
+
+// Number of recovery codes handed out when 2FA is enabled
+const recoveryCodeCount = 10
+
+var (
+	ErrTwoFactorEnabled    = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorNotSetUp   = errors.New("two-factor authentication has not been set up")
+	ErrInvalidTwoFactor    = errors.New("invalid two-factor code")
+)
+
+// RecoveryCode is a single-use code that stands in for a TOTP code when the
+// user has lost their authenticator. Only its hash is stored.
+type RecoveryCode struct {
+	gorm.Model
+	UserID   uint   `gorm:"index;not null"`
+	CodeHash string `gorm:"type:char(64);not null"`
+	UsedAt   *time.Time
+}
+
+func init() {
+	db = config.GetDB()
+	db.AutoMigrate(&RecoveryCode{})
+}
+
+// TwoFactorEnabled reports whether logins need a second factor
+func (u *User) TwoFactorEnabled() bool {
+	return u.TwoFactorEnabledAt != nil && u.TOTPSecret != nil
+}
+
+// TwoFactorRequired reports whether policy requires the user to use 2FA
+// (staff accounts, when REQUIRE_STAFF_2FA is set)
+func (u *User) TwoFactorRequired() bool {
+	return (u.IsAdmin || u.IsEmployee) && config.RequireStaffTwoFactor()
+}
+
+// BeginTwoFactorSetup stores a new TOTP secret and returns it together with
+// the otpauth:// URI for authenticator apps. Logins do not use it until
+// EnableTwoFactor confirms the user can generate codes.
+func (u *User) BeginTwoFactorSetup() (string, string, error) {
+	if u.TwoFactorEnabled() {
+		return "", "", ErrTwoFactorEnabled
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return "", "", err
+	}
+
+	u.TOTPSecret = &secret
+	u.TOTPLastStep = 0
+	if err := db.Model(u).Select("totp_secret", "totp_last_step").Updates(u).Error; err != nil {
+		return "", "", err
+	}
+
+	return secret, utils.TOTPProvisioningURI(TwoFactorIssuer, u.Email, secret), nil
+}
+
+// EnableTwoFactor turns on 2FA once code proves the authenticator is set up,
+// and returns a fresh set of recovery codes
+func (u *User) EnableTwoFactor(code string) ([]string, error) {
+	if u.TwoFactorEnabled() {
+		return nil, ErrTwoFactorEnabled
+	}
+	if u.TOTPSecret == nil {
+		return nil, ErrTwoFactorNotSetUp
+	}
+	if !u.useTOTPCode(code) {
+		return nil, ErrInvalidTwoFactor
+	}
+
+	now := time.Now()
+	u.TwoFactorEnabledAt = &now
+	if err := db.Model(u).Select("two_factor_enabled_at").Updates(u).Error; err != nil {
+		return nil, err
+	}
+
+	return u.RegenerateRecoveryCodes()
+}
+
+// DisableTwoFactor turns off 2FA and discards the secret and recovery codes
+func (u *User) DisableTwoFactor() error {
+	if !u.TwoFactorEnabled() {
+		return ErrTwoFactorNotEnabled
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		u.TOTPSecret = nil
+		u.TOTPLastStep = 0
+		u.TwoFactorEnabledAt = nil
+		if err := tx.Model(u).Select("totp_secret", "totp_last_step", "two_factor_enabled_at").Updates(u).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", u.ID).Delete(&RecoveryCode{}).Error
+	})
+}
+
+// VerifyTwoFactor checks a TOTP code or, failing that, a recovery code.
+// Either works only once.
+func (u *User) VerifyTwoFactor(code string) bool {
+	if !u.TwoFactorEnabled() {
+		return false
+	}
+	return u.useTOTPCode(code) || u.useRecoveryCode(code)
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes. The plain
+// codes are returned once and cannot be shown again.
+func (u *User) RegenerateRecoveryCodes() ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	rows := make([]RecoveryCode, recoveryCodeCount)
+	for i := range codes {
+		random, err := utils.GenerateTOTPSecret()
+		if err != nil {
+			return nil, err
+		}
+		plain := strings.ToLower(random[:5] + "-" + random[5:10])
+		codes[i] = plain
+		rows[i] = RecoveryCode{UserID: u.ID, CodeHash: utils.HashToken(normalizeRecoveryCode(plain))}
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", u.ID).Delete(&RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&rows).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// RemainingRecoveryCodes counts the unused recovery codes
+func (u *User) RemainingRecoveryCodes() int64 {
+	var count int64
+	db.Model(&RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", u.ID).Count(&count)
+	return count
+}
+
+// useTOTPCode accepts a TOTP code for a time step later than any accepted
+// before. The guarded update makes concurrent use of one code fail.
+func (u *User) useTOTPCode(code string) bool {
+	if u.TOTPSecret == nil {
+		return false
+	}
+
+	step, ok := utils.VerifyTOTP(*u.TOTPSecret, code, time.Now())
+	if !ok || step <= u.TOTPLastStep {
+		return false
+	}
+
+	result := db.Model(&User{}).Where("id = ? AND totp_last_step < ?", u.ID, step).Update("totp_last_step", step)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false
+	}
+	u.TOTPLastStep = step
+	return true
+}
+
+func (u *User) useRecoveryCode(code string) bool {
+	code = normalizeRecoveryCode(code)
+	if code == "" {
+		return false
+	}
+
+	result := db.Model(&RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", u.ID, utils.HashToken(code)).
+		Update("used_at", time.Now())
+	return result.Error == nil && result.RowsAffected == 1
+}
+
+// normalizeRecoveryCode ignores case, spaces and dashes
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
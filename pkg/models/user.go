@@ -1,7 +1,12 @@
 package models
 
 import (
+	"errors"
+	"strings"
+	"time"
+
 	"api/pkg/config"
+	"api/pkg/utils"
 
 	"golang.org/x/crypto/bcrypt"
 
@@ -10,10 +15,37 @@ import (
 
 type User struct {
 	gorm.Model
-	Email      string `json:"email" gorm:"unique"`
-	Password   string `json:"password"`
-	IsAdmin    bool   `json:"is_admin" gorm:"default:false"`
-	IsEmployee bool   `json:"is_employee" gorm:"default:false"` // Add this line
+	Email      string     `json:"email" gorm:"unique"`
+	Password   string     `json:"-"`
+	IsAdmin    bool       `json:"is_admin" gorm:"default:false"`
+	IsEmployee bool       `json:"is_employee" gorm:"default:false"`
+	DisabledAt *time.Time `json:"disabled_at"` // Disabled accounts cannot log in
+
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+
+	// Profile, edited by the user through /api/me, see profile.go
+	Name                    *string                 `json:"name" gorm:"type:varchar(255)"`
+	Phone                   *string                 `json:"phone" gorm:"type:varchar(32)"`
+	Company                 *string                 `json:"company" gorm:"type:varchar(255)"`
+	AvatarURL               *string                 `json:"avatar_url" gorm:"type:varchar(2048)"`
+	NotificationPreferences NotificationPreferences `json:"notification_preferences" gorm:"serializer:json"`
+
+	// Brute-force protection, see RecordFailedLogin
+	FailedLoginAttempts int        `json:"-" gorm:"not null;default:0"`
+	LastFailedLoginAt   *time.Time `json:"-"`
+	LockedUntil         *time.Time `json:"locked_until"`
+
+	// Two-factor authentication, see two-factor.go. TOTPSecret is set during
+	// setup and only used for login once TwoFactorEnabledAt is set.
+	TOTPSecret         *string    `json:"-" gorm:"type:varchar(64)"`
+	TOTPLastStep       int64      `json:"-" gorm:"not null;default:0"` // last accepted time step, codes cannot be replayed
+	TwoFactorEnabledAt *time.Time `json:"two_factor_enabled_at"`
+
+	// Access tokens issued before this moment are rejected, see RevokeUserTokens
+	TokensRevokedAt *time.Time `json:"-" gorm:"precision:6"`
+
+	// Password reset links sent before this moment are rejected
+	PasswordChangedAt *time.Time `json:"-" gorm:"precision:6"`
 }
 
 func init() {
@@ -123,3 +155,205 @@ func GetUserByEmail(email string) (*User, error) {
 	}
 	return &user, nil
 }
+
+var ErrLastAdmin = errors.New("at least one active admin account is required")
+
+// Failed logins first slow an account down (1s, 2s, 4s, ... after
+// loginBackoffThreshold failures) and lock it for loginLockoutDuration after
+// loginLockoutThreshold failures in a row
+const (
+	loginBackoffThreshold = 3
+	loginBackoffBase      = 1 * time.Second
+	loginBackoffMax       = 1 * time.Minute
+	loginLockoutThreshold = 10
+	loginLockoutDuration  = 15 * time.Minute
+)
+
+// Failed logins for emails without an account are throttled the same way,
+// in memory, so the answers do not reveal which emails have one
+var unknownLoginThrottle = utils.NewThrottle(loginBackoffThreshold, loginBackoffBase, loginBackoffMax).
+	WithLockout(loginLockoutThreshold, loginLockoutDuration)
+
+// UnknownLoginRetryAfter is LoginRetryAfter for an email without an account
+func UnknownLoginRetryAfter(email string) time.Duration {
+	return unknownLoginThrottle.RetryAfter(strings.ToLower(email))
+}
+
+// RecordUnknownLogin is RecordFailedLogin for an email without an account
+func RecordUnknownLogin(email string) {
+	unknownLoginThrottle.Fail(strings.ToLower(email))
+}
+
+func GetUserById(ID uint) (*User, error) {
+	var user User
+	if err := db.First(&user, ID).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetPaginatedUsers lists users, newest first, optionally narrowed to emails
+// containing search
+func GetPaginatedUsers(limit int, offset int, search string) ([]User, int64) {
+	var users []User
+	var total int64
+
+	query := db.Model(&User{})
+	if search != "" {
+		query = query.Where("LOWER(email) LIKE ?", "%"+strings.ToLower(search)+"%")
+	}
+
+	query.Count(&total)
+	query.Order("created_at DESC, id DESC").Limit(limit).Offset(offset).Find(&users)
+
+	return users, total
+}
+
+// IsDisabled reports whether the account has been disabled by an admin
+func (u *User) IsDisabled() bool {
+	return u.DisabledAt != nil
+}
+
+// SetRoles changes the user's admin and employee flags. Demoting the last
+// active admin is refused so the system cannot be locked out. Access tokens
+// carry the roles, so a change signs the user out everywhere.
+func (u *User) SetRoles(isAdmin bool, isEmployee bool) error {
+	if u.IsAdmin && !isAdmin {
+		if err := u.ensureAnotherAdmin(); err != nil {
+			return err
+		}
+	}
+
+	changed := u.IsAdmin != isAdmin || u.IsEmployee != isEmployee
+	u.IsAdmin = isAdmin
+	u.IsEmployee = isEmployee
+	if err := db.Model(u).Select("is_admin", "is_employee").Updates(u).Error; err != nil {
+		return err
+	}
+
+	if changed {
+		return RevokeUserTokens(u.ID)
+	}
+	return nil
+}
+
+// SetDisabled disables or re-enables the account
+func (u *User) SetDisabled(disabled bool) error {
+	if disabled && u.IsAdmin && !u.IsDisabled() {
+		if err := u.ensureAnotherAdmin(); err != nil {
+			return err
+		}
+	}
+
+	if disabled {
+		now := time.Now()
+		u.DisabledAt = &now
+	} else {
+		u.DisabledAt = nil
+	}
+	if err := db.Model(u).Select("disabled_at").Updates(u).Error; err != nil {
+		return err
+	}
+
+	// Sign the user out everywhere
+	if disabled {
+		return RevokeUserTokens(u.ID)
+	}
+	return nil
+}
+
+func (u *User) ensureAnotherAdmin() error {
+	var admins int64
+	db.Model(&User{}).Where("is_admin = ? AND disabled_at IS NULL AND id <> ?", true, u.ID).Count(&admins)
+	if admins == 0 {
+		return ErrLastAdmin
+	}
+	return nil
+}
+
+// MarkEmailVerified records that the user proved they own their email
+func (u *User) MarkEmailVerified() error {
+	now := time.Now()
+	u.EmailVerifiedAt = &now
+	return db.Model(u).Select("email_verified_at").Updates(u).Error
+}
+
+// UpdatePassword hashes and stores a new password
+func (u *User) UpdatePassword(plainPassword string) error {
+	if err := u.HashPassword(plainPassword); err != nil {
+		return err
+	}
+	// Stored at the precision of token issue times, see RevokeUserTokens
+	now := time.Now().Truncate(utils.TokenTimePrecision)
+	u.PasswordChangedAt = &now
+	return db.Model(u).Select("password", "password_changed_at").Updates(u).Error
+}
+
+// PasswordChangedSince reports whether the password was changed at or after
+// t, which voids the password reset links sent before
+func (u *User) PasswordChangedSince(t time.Time) bool {
+	return u.PasswordChangedAt != nil && !u.PasswordChangedAt.Before(t)
+}
+
+// LoginRetryAfter returns how long the account must wait before another
+// login attempt is checked, or 0 when it may try now
+func (u *User) LoginRetryAfter() time.Duration {
+	now := time.Now()
+	if u.LockedUntil != nil && u.LockedUntil.After(now) {
+		return u.LockedUntil.Sub(now)
+	}
+
+	if u.LastFailedLoginAt == nil {
+		return 0
+	}
+	wait := utils.Backoff(u.FailedLoginAttempts, loginBackoffThreshold, loginBackoffBase, loginBackoffMax)
+	if left := u.LastFailedLoginAt.Add(wait).Sub(now); left > 0 {
+		return left
+	}
+	return 0
+}
+
+// IsLocked reports whether the account is temporarily locked
+func (u *User) IsLocked() bool {
+	return u.LockedUntil != nil && u.LockedUntil.After(time.Now())
+}
+
+// RecordFailedLogin counts a failed login and locks the account once the
+// lockout threshold is reached
+func (u *User) RecordFailedLogin() error {
+	now := time.Now()
+	if err := db.Model(u).Updates(map[string]interface{}{
+		"failed_login_attempts": gorm.Expr("failed_login_attempts + 1"),
+		"last_failed_login_at":  now,
+	}).Error; err != nil {
+		return err
+	}
+
+	if err := db.Select("failed_login_attempts", "last_failed_login_at", "locked_until").First(u, u.ID).Error; err != nil {
+		return err
+	}
+
+	if u.FailedLoginAttempts >= loginLockoutThreshold {
+		lockedUntil := now.Add(loginLockoutDuration)
+		u.LockedUntil = &lockedUntil
+		u.FailedLoginAttempts = 0
+		return db.Model(u).Select("locked_until", "failed_login_attempts").Updates(u).Error
+	}
+	return nil
+}
+
+// ResetFailedLogins clears the failure count after a successful login
+func (u *User) ResetFailedLogins() error {
+	if u.FailedLoginAttempts == 0 && u.LockedUntil == nil && u.LastFailedLoginAt == nil {
+		return nil
+	}
+	return u.Unlock()
+}
+
+// Unlock lifts a lockout and clears the failure count
+func (u *User) Unlock() error {
+	u.FailedLoginAttempts = 0
+	u.LastFailedLoginAt = nil
+	u.LockedUntil = nil
+	return db.Model(u).Select("failed_login_attempts", "last_failed_login_at", "locked_until").Updates(u).Error
+}
@@ -1,8 +1,11 @@
 package routes
 
 import (
+	"net/http"
+
 	"api/pkg/controllers"
 	"api/pkg/middleware"
+	"api/pkg/storage"
 
 	"github.com/gorilla/mux"
 )
@@ -11,17 +14,109 @@ var RegisterRoutes = func(router *mux.Router) {
 	// Public routes (no authentication required)
 	router.HandleFunc("/auth/register", controllers.Register).Methods("POST")
 	router.HandleFunc("/auth/login", controllers.Login).Methods("POST")
+	router.HandleFunc("/auth/login/2fa", controllers.LoginTwoFactor).Methods("POST")
+	router.HandleFunc("/auth/refresh", controllers.Refresh).Methods("POST")
+	router.HandleFunc("/auth/logout", controllers.Logout).Methods("POST")
+	router.HandleFunc("/auth/forgot-password", controllers.ForgotPassword).Methods("POST")
+	router.HandleFunc("/auth/reset-password", controllers.ResetPassword).Methods("POST")
+	router.HandleFunc("/auth/verify-email", controllers.VerifyEmail).Methods("GET")
+	router.HandleFunc("/.well-known/jwks.json", controllers.GetJWKS).Methods("GET")
 
 	// Public property routes (read-only and create)
 	router.HandleFunc("/properties", controllers.GetProperties).Methods("GET")
 	router.HandleFunc("/properties/{PropertyId}", controllers.GetPropertyById).Methods("GET")
-	router.HandleFunc("/properties", controllers.CreateProperty).Methods("POST") // Users can submit properties
+	router.HandleFunc("/properties/{PropertyId}/analysis", controllers.GetPropertyAnalysis).Methods("GET")
+	router.HandleFunc("/properties/{PropertyId}/financing", controllers.GetFinancingTerms).Methods("GET")
+	router.HandleFunc("/properties/{PropertyId}/financing/{TermId}/amortization", controllers.GetAmortizationSchedule).Methods("GET")
+	// Documents: what the caller may see depends on who they are
+	router.Handle("/properties/{PropertyId}/documents", middleware.OptionalAuthMiddleware(http.HandlerFunc(controllers.GetPropertyDocuments))).Methods("GET")
+	router.Handle("/properties/{PropertyId}/documents/{DocumentId}/link", middleware.OptionalAuthMiddleware(http.HandlerFunc(controllers.GetPropertyDocumentLink))).Methods("GET")
+	router.HandleFunc("/documents/download", controllers.DownloadDocument).Methods("GET")
+	// Uploaded photos, when they are stored on the local filesystem
+	if local, ok := storage.Default().(*storage.LocalStorage); ok {
+		router.PathPrefix(local.URLPath() + "/").Handler(http.StripPrefix(local.URLPath(), local.Handler())).Methods("GET")
+	}
+
+	// Users can submit properties; signed-in submissions are linked to the user
+	router.Handle("/properties", middleware.OptionalAuthMiddleware(http.HandlerFunc(controllers.CreateProperty))).Methods("POST")
+	// Buyers send interest in a listing; signed-in inquiries are linked to the user
+	router.Handle("/properties/{PropertyId}/inquiries", middleware.OptionalAuthMiddleware(http.HandlerFunc(controllers.CreateInquiry))).Methods("POST")
 
 	// Protected routes (authentication required) - Admin operations
 	apiRouter := router.PathPrefix("/api").Subrouter()
 	apiRouter.Use(middleware.AuthMiddleware)
 
-	// Protected property operations - only authenticated users can edit/delete
-	apiRouter.HandleFunc("/properties/{PropertyId}", controllers.UpdateProperty).Methods("PUT")
-	apiRouter.HandleFunc("/properties/{PropertyId}", controllers.DeleteProperty).Methods("DELETE")
+	// Protected property operations - staff can edit/delete any property, users only their own
+	canUpdate := middleware.RequireAnyPermission(middleware.PermissionUpdateProperty, middleware.PermissionUpdateOwnProperty)
+	canDelete := middleware.RequireAnyPermission(middleware.PermissionDeleteProperty, middleware.PermissionDeleteOwnProperty)
+	apiRouter.Handle("/properties/{PropertyId}", canUpdate(http.HandlerFunc(controllers.UpdateProperty))).Methods("PUT")
+	apiRouter.Handle("/properties/{PropertyId}", canUpdate(http.HandlerFunc(controllers.PatchProperty))).Methods("PATCH")
+	apiRouter.Handle("/properties/{PropertyId}", canDelete(http.HandlerFunc(controllers.DeleteProperty))).Methods("DELETE")
+	apiRouter.Handle("/properties/{PropertyId}/financing", canUpdate(http.HandlerFunc(controllers.CreateFinancingTerm))).Methods("POST")
+	apiRouter.Handle("/properties/{PropertyId}/financing/{TermId}", canUpdate(http.HandlerFunc(controllers.UpdateFinancingTerm))).Methods("PUT")
+	apiRouter.Handle("/properties/{PropertyId}/financing/{TermId}", canUpdate(http.HandlerFunc(controllers.DeleteFinancingTerm))).Methods("DELETE")
+	apiRouter.Handle("/properties/{PropertyId}/images", canUpdate(http.HandlerFunc(controllers.UploadPropertyImages))).Methods("POST")
+	apiRouter.Handle("/properties/{PropertyId}/images/order", canUpdate(http.HandlerFunc(controllers.ReorderPropertyImages))).Methods("PUT")
+	apiRouter.Handle("/properties/{PropertyId}/images/{ImageId}/cover", canUpdate(http.HandlerFunc(controllers.SetPropertyCoverImage))).Methods("PUT")
+	apiRouter.Handle("/properties/{PropertyId}/images/{ImageId}", canUpdate(http.HandlerFunc(controllers.DeletePropertyImage))).Methods("DELETE")
+	apiRouter.Handle("/properties/{PropertyId}/documents", canUpdate(http.HandlerFunc(controllers.UploadPropertyDocument))).Methods("POST")
+	apiRouter.Handle("/properties/{PropertyId}/documents/{DocumentId}", canUpdate(http.HandlerFunc(controllers.UpdatePropertyDocument))).Methods("PATCH")
+	apiRouter.Handle("/properties/{PropertyId}/documents/{DocumentId}", canUpdate(http.HandlerFunc(controllers.DeletePropertyDocument))).Methods("DELETE")
+
+	// Buyers sign a property's NDA to see its NDA documents
+	apiRouter.Handle("/properties/{PropertyId}/nda", middleware.RejectAPIKeys(http.HandlerFunc(controllers.GetPropertyNDA))).Methods("GET")
+	apiRouter.Handle("/properties/{PropertyId}/nda", middleware.RejectAPIKeys(http.HandlerFunc(controllers.SignPropertyNDA))).Methods("POST")
+
+	// Offers: buyers make them, the seller side answers, and either side counters
+	apiRouter.Handle("/properties/{PropertyId}/offers", middleware.RejectAPIKeys(http.HandlerFunc(controllers.GetPropertyOffers))).Methods("GET")
+	apiRouter.Handle("/properties/{PropertyId}/offers", middleware.RejectAPIKeys(http.HandlerFunc(controllers.SubmitOffer))).Methods("POST")
+	offerRouter := apiRouter.PathPrefix("/offers/{OfferId}").Subrouter()
+	offerRouter.Use(middleware.RejectAPIKeys)
+	offerRouter.HandleFunc("", controllers.GetOffer).Methods("GET")
+	offerRouter.HandleFunc("/counter", controllers.CounterOffer).Methods("POST")
+	offerRouter.HandleFunc("/accept", controllers.AcceptOffer).Methods("POST")
+	offerRouter.HandleFunc("/reject", controllers.RejectOffer).Methods("POST")
+	offerRouter.HandleFunc("/withdraw", controllers.WithdrawOffer).Methods("POST")
+	offerRouter.HandleFunc("/close", controllers.CloseOffer).Methods("POST")
+
+	// The authenticated user's own resources
+	meRouter := apiRouter.PathPrefix("/me").Subrouter()
+	meRouter.Use(middleware.RejectAPIKeys)
+	meRouter.HandleFunc("", controllers.GetMe).Methods("GET")
+	meRouter.HandleFunc("", controllers.PatchMe).Methods("PATCH")
+	meRouter.HandleFunc("", controllers.DeleteMe).Methods("DELETE")
+	meRouter.HandleFunc("/password", controllers.ChangePassword).Methods("POST")
+	meRouter.HandleFunc("/properties", controllers.GetMyProperties).Methods("GET")
+	meRouter.HandleFunc("/offers", controllers.GetMyOffers).Methods("GET")
+	meRouter.HandleFunc("/verify-email", controllers.ResendVerificationEmail).Methods("POST")
+	meRouter.HandleFunc("/2fa", controllers.GetTwoFactorStatus).Methods("GET")
+	meRouter.HandleFunc("/2fa/setup", controllers.SetupTwoFactor).Methods("POST")
+	meRouter.HandleFunc("/2fa/enable", controllers.EnableTwoFactor).Methods("POST")
+	meRouter.HandleFunc("/2fa/disable", controllers.DisableTwoFactor).Methods("POST")
+	meRouter.HandleFunc("/2fa/recovery-codes", controllers.RegenerateRecoveryCodes).Methods("POST")
+
+	// API keys for partners and scripts
+	apiKeyRouter := apiRouter.PathPrefix("/admin/api-keys").Subrouter()
+	apiKeyRouter.Use(middleware.RequirePermission(middleware.PermissionManageAPIKeys))
+	apiKeyRouter.HandleFunc("", controllers.GetAPIKeys).Methods("GET")
+	apiKeyRouter.HandleFunc("", controllers.CreateAPIKey).Methods("POST")
+	apiKeyRouter.HandleFunc("/{KeyId}", controllers.RevokeAPIKey).Methods("DELETE")
+
+	// Leads inbox
+	leadRouter := apiRouter.PathPrefix("/leads").Subrouter()
+	leadRouter.Use(middleware.RequirePermission(middleware.PermissionManageLeads))
+	leadRouter.HandleFunc("", controllers.GetLeads).Methods("GET")
+	leadRouter.HandleFunc("/{LeadId}", controllers.GetLead).Methods("GET")
+	leadRouter.HandleFunc("/{LeadId}", controllers.UpdateLead).Methods("PATCH")
+	leadRouter.HandleFunc("/{LeadId}/notes", controllers.AddLeadNote).Methods("POST")
+
+	// Admin user management
+	adminRouter := apiRouter.PathPrefix("/admin").Subrouter()
+	adminRouter.Use(middleware.RequirePermission(middleware.PermissionManageUsers))
+	adminRouter.HandleFunc("/users", controllers.GetUsers).Methods("GET")
+	adminRouter.HandleFunc("/users", controllers.CreateUser).Methods("POST")
+	adminRouter.HandleFunc("/users/{UserId}", controllers.UpdateUserRoles).Methods("PATCH")
+	adminRouter.HandleFunc("/users/{UserId}/disable", controllers.DisableUser).Methods("POST")
+	adminRouter.HandleFunc("/users/{UserId}/enable", controllers.EnableUser).Methods("POST")
+	adminRouter.HandleFunc("/users/{UserId}/unlock", controllers.UnlockUser).Methods("POST")
 }
@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// roundTrip exercises the Storage interface the way the models use it
+func roundTrip(t *testing.T, s Storage) {
+	t.Helper()
+	ctx := context.Background()
+	key := "documents/properties/7/contract.pdf"
+	body := "%PDF-1.7 contract"
+
+	if err := s.Put(ctx, key, strings.NewReader(body), int64(len(body)), "application/pdf"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	file, err := s.Open(ctx, key)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	got, err := io.ReadAll(file)
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != body {
+		t.Errorf("Open read %q, want %q", got, body)
+	}
+
+	// Putting the same key again replaces the object
+	if err := s.Put(ctx, key, strings.NewReader("v2"), 2, "application/pdf"); err != nil {
+		t.Fatalf("Put again: %v", err)
+	}
+	file, err = s.Open(ctx, key)
+	if err != nil {
+		t.Fatalf("Open again: %v", err)
+	}
+	got, _ = io.ReadAll(file)
+	file.Close()
+	if string(got) != "v2" {
+		t.Errorf("Open after replace read %q, want %q", got, "v2")
+	}
+
+	if err := s.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := s.Open(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Open after Delete: err = %v, want ErrNotFound", err)
+	}
+	// Deleting what is already gone is not an error
+	if err := s.Delete(ctx, key); err != nil {
+		t.Errorf("Delete of a missing object: %v", err)
+	}
+
+	for _, bad := range []string{"", "/etc/passwd", "../secret", "images/../../secret", "images//a.jpg", `images\a.jpg`} {
+		if err := s.Put(ctx, bad, strings.NewReader("x"), 1, "text/plain"); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Put(%q): err = %v, want ErrInvalidKey", bad, err)
+		}
+		if _, err := s.Open(ctx, bad); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Open(%q): err = %v, want ErrInvalidKey", bad, err)
+		}
+	}
+}
+
+func TestLocalStorage(t *testing.T) {
+	dir := t.TempDir()
+	s := &LocalStorage{Dir: dir, BaseURL: "http://localhost:8080/uploads"}
+	roundTrip(t, s)
+
+	// No temporary files are left behind
+	entries, err := os.ReadDir(filepath.Join(dir, "documents", "properties", "7"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("files left in the storage directory: %v", entries)
+	}
+}
+
+func TestLocalStorageURL(t *testing.T) {
+	s := &LocalStorage{Dir: t.TempDir(), BaseURL: "https://api.example.com/files"}
+	if got := s.URL("images/properties/1/a.jpg"); got != "https://api.example.com/files/images/properties/1/a.jpg" {
+		t.Errorf("URL = %s", got)
+	}
+	if got := s.URLPath(); got != "/files" {
+		t.Errorf("URLPath = %s, want /files", got)
+	}
+	if got := (&LocalStorage{BaseURL: "http://localhost:8080"}).URLPath(); got != "/uploads" {
+		t.Errorf("URLPath without a path = %s, want /uploads", got)
+	}
+}
+
+func TestLocalStorageHandler(t *testing.T) {
+	s := &LocalStorage{Dir: t.TempDir(), BaseURL: "http://localhost:8080/uploads"}
+	ctx := context.Background()
+	for key, body := range map[string]string{
+		"images/properties/1/a.jpg":       "jpeg",
+		"documents/properties/1/deed.pdf": "private",
+	} {
+		if err := s.Put(ctx, key, strings.NewReader(body), int64(len(body)), ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		path       string
+		wantStatus int
+	}{
+		{"/images/properties/1/a.jpg", http.StatusOK},
+		{"/images/properties/1/missing.jpg", http.StatusNotFound},
+		{"/documents/properties/1/deed.pdf", http.StatusNotFound}, // not public
+		{"/images/properties/1/", http.StatusNotFound},            // no listings
+		{"/images/../documents/properties/1/deed.pdf", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/uploads", nil)
+		req.URL.Path = tt.path
+		s.Handler().ServeHTTP(rec, req)
+		if rec.Code != tt.wantStatus {
+			t.Errorf("GET %s = %d, want %d", tt.path, rec.Code, tt.wantStatus)
+		}
+		if rec.Code == http.StatusOK && rec.Header().Get("X-Content-Type-Options") != "nosniff" {
+			t.Errorf("GET %s is missing X-Content-Type-Options", tt.path)
+		}
+	}
+}
+
+func TestCleanKey(t *testing.T) {
+	valid := []string{"a", "images/properties/1/a.jpg", "documents/x y.pdf"}
+	for _, key := range valid {
+		if got, err := CleanKey(key); err != nil || got != key {
+			t.Errorf("CleanKey(%q) = %q, %v", key, got, err)
+		}
+	}
+
+	invalid := []string{"", ".", "..", "/a", "../a", "a/../../b", "a/./b", "a//b", "a/", `a\b`}
+	for _, key := range invalid {
+		if _, err := CleanKey(key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("CleanKey(%q) accepted the key", key)
+		}
+	}
+}
+
+func TestSetDefault(t *testing.T) {
+	previous := Default()
+	defer SetDefault(previous)
+
+	s := &LocalStorage{Dir: t.TempDir()}
+	SetDefault(s)
+	if Default() != Storage(s) {
+		t.Error("Default did not return the storage given to SetDefault")
+	}
+}
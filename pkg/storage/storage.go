@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrNotFound   = errors.New("object not found")
+	ErrInvalidKey = errors.New("invalid object key")
+)
+
+// Storage keeps uploaded files. Keys are slash separated paths such as
+// "images/properties/12/3f9c2a.jpg". LocalStorage is used in development,
+// S3Storage in production against AWS S3 or any S3 compatible service.
+type Storage interface {
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	// URL is where clients download the object, for objects that are public
+	URL(key string) string
+}
+
+// Keys under this prefix are publicly readable: LocalStorage serves them and
+// an S3 bucket policy should grant anonymous reads on them
+const PublicPrefix = "images/"
+
+var (
+	defaultStorage   Storage
+	defaultStorageMu sync.Mutex
+)
+
+// Default returns the storage configured through the environment: S3 when
+// STORAGE_DRIVER is "s3", otherwise the local filesystem
+func Default() Storage {
+	defaultStorageMu.Lock()
+	defer defaultStorageMu.Unlock()
+
+	if defaultStorage == nil {
+		switch os.Getenv("STORAGE_DRIVER") {
+		case "s3":
+			defaultStorage = NewS3StorageFromEnv()
+		case "", "local":
+			defaultStorage = NewLocalStorageFromEnv()
+		default:
+			fmt.Printf("unknown STORAGE_DRIVER %q, storing files locally\n", os.Getenv("STORAGE_DRIVER"))
+			defaultStorage = NewLocalStorageFromEnv()
+		}
+	}
+
+	return defaultStorage
+}
+
+// SetDefault replaces the storage returned by Default, for programs that
+// configure storage in code instead of through the environment
+func SetDefault(storage Storage) {
+	defaultStorageMu.Lock()
+	defer defaultStorageMu.Unlock()
+	defaultStorage = storage
+}
+
+// CleanKey checks that key is a relative slash separated path that stays
+// inside the storage root and returns it in canonical form
+func CleanKey(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return "", ErrInvalidKey
+	}
+	cleaned := path.Clean(key)
+	if cleaned != key || cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", ErrInvalidKey
+	}
+	return cleaned, nil
+}
@@ -0,0 +1,312 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Tokens are signed with an RSA (RS256) or Ed25519 (EdDSA) private key so
+// other services can verify them with the public keys published at
+// /.well-known/jwks.json, without holding any secret.
+//
+// Keys are configured through the environment:
+//
+//	JWT_SIGNING_KEY_FILE        PEM file with the private key used to sign
+//	JWT_SIGNING_KEY             the same PEM inline, when a file is awkward
+//	JWT_VERIFICATION_KEY_FILES  comma-separated PEM files with public (or
+//	                            private) keys that are still accepted, e.g.
+//	                            the previous signing key during a rotation
+//
+// Each key is identified by its RFC 7638 thumbprint, sent as the kid header.
+
+var ErrNoSigningKey = errors.New("no JWT signing key configured: set JWT_SIGNING_KEY_FILE or JWT_SIGNING_KEY")
+
+// minRSABits is the smallest RSA key accepted
+const minRSABits = 2048
+
+// jwtKey is a verification key with its identifier
+type jwtKey struct {
+	ID     string
+	Method jwt.SigningMethod
+	Public crypto.PublicKey
+}
+
+// jwtKeySet is the signing key plus every key tokens are accepted from
+type jwtKeySet struct {
+	signingKey crypto.Signer
+	signing    *jwtKey
+	verify     map[string]*jwtKey
+	order      []string // kids in configuration order, for the JWKS
+}
+
+var keys atomic.Pointer[jwtKeySet]
+
+// LoadSigningKeys reads the JWT keys from the environment. It must succeed
+// before tokens can be issued or validated; main refuses to start otherwise.
+func LoadSigningKeys() error {
+	signingPEM := []byte(os.Getenv("JWT_SIGNING_KEY"))
+	if path := os.Getenv("JWT_SIGNING_KEY_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("reading JWT_SIGNING_KEY_FILE: %w", err)
+		}
+		signingPEM = data
+	}
+	if len(strings.TrimSpace(string(signingPEM))) == 0 {
+		return ErrNoSigningKey
+	}
+
+	var verificationPEMs [][]byte
+	for _, path := range strings.Split(os.Getenv("JWT_VERIFICATION_KEY_FILES"), ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("reading JWT verification key %s: %w", path, err)
+		}
+		verificationPEMs = append(verificationPEMs, data)
+	}
+
+	set, err := newJWTKeySet(signingPEM, verificationPEMs...)
+	if err != nil {
+		return err
+	}
+	keys.Store(set)
+	return nil
+}
+
+func newJWTKeySet(signingPEM []byte, verificationPEMs ...[]byte) (*jwtKeySet, error) {
+	signers, err := parsePEMKeys(signingPEM)
+	if err != nil {
+		return nil, fmt.Errorf("JWT signing key: %w", err)
+	}
+	if len(signers) != 1 {
+		return nil, fmt.Errorf("JWT signing key: expected exactly one key, found %d", len(signers))
+	}
+	signer, ok := signers[0].(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("JWT signing key: a private key is required")
+	}
+
+	set := &jwtKeySet{signingKey: signer, verify: map[string]*jwtKey{}}
+
+	set.signing, err = set.add(signer.Public())
+	if err != nil {
+		return nil, fmt.Errorf("JWT signing key: %w", err)
+	}
+
+	for _, data := range verificationPEMs {
+		parsed, err := parsePEMKeys(data)
+		if err != nil {
+			return nil, fmt.Errorf("JWT verification key: %w", err)
+		}
+		for _, key := range parsed {
+			if signer, ok := key.(crypto.Signer); ok {
+				key = signer.Public()
+			}
+			if _, err := set.add(key); err != nil {
+				return nil, fmt.Errorf("JWT verification key: %w", err)
+			}
+		}
+	}
+
+	return set, nil
+}
+
+// add registers a public key for verification, once per thumbprint
+func (s *jwtKeySet) add(public crypto.PublicKey) (*jwtKey, error) {
+	var method jwt.SigningMethod
+	switch k := public.(type) {
+	case *rsa.PublicKey:
+		if k.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("RSA keys must be at least %d bits", minRSABits)
+		}
+		method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported key type %T, use RSA or Ed25519", public)
+	}
+
+	kid, err := keyThumbprint(public)
+	if err != nil {
+		return nil, err
+	}
+	if existing, ok := s.verify[kid]; ok {
+		return existing, nil
+	}
+
+	key := &jwtKey{ID: kid, Method: method, Public: public}
+	s.verify[kid] = key
+	s.order = append(s.order, kid)
+	return key, nil
+}
+
+// parsePEMKeys returns every key in a PEM document, which may hold several
+func parsePEMKeys(data []byte) ([]interface{}, error) {
+	var parsed []interface{}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		var key interface{}
+		var err error
+		switch block.Type {
+		case "PRIVATE KEY":
+			key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		case "RSA PRIVATE KEY":
+			key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		case "PUBLIC KEY":
+			key, err = x509.ParsePKIXPublicKey(block.Bytes)
+		case "RSA PUBLIC KEY":
+			key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+		default:
+			return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+		}
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, key)
+	}
+
+	if len(parsed) == 0 {
+		return nil, fmt.Errorf("no PEM encoded key found")
+	}
+	return parsed, nil
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517)
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+	Curve     string `json:"crv,omitempty"` // OKP
+	X         string `json:"x,omitempty"`   // OKP
+	N         string `json:"n,omitempty"`   // RSA
+	E         string `json:"e,omitempty"`   // RSA
+}
+
+// JWKS is the document served at /.well-known/jwks.json
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicJWKS returns every key tokens are currently accepted from, the
+// signing key first
+func PublicJWKS() JWKS {
+	set := keys.Load()
+	jwks := JWKS{Keys: []JWK{}}
+	if set == nil {
+		return jwks
+	}
+
+	for _, kid := range set.order {
+		key := set.verify[kid]
+		jwk := publicJWK(key.Public)
+		jwk.Use = "sig"
+		jwk.Algorithm = key.Method.Alg()
+		jwk.KeyID = kid
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	return jwks
+}
+
+func publicJWK(public crypto.PublicKey) JWK {
+	switch k := public.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			KeyType: "RSA",
+			N:       base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+			E:       base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+		}
+	case ed25519.PublicKey:
+		return JWK{
+			KeyType: "OKP",
+			Curve:   "Ed25519",
+			X:       base64.RawURLEncoding.EncodeToString(k),
+		}
+	}
+	return JWK{}
+}
+
+// keyThumbprint computes the RFC 7638 thumbprint of a public key: the
+// SHA-256 of its required JWK members in lexicographic order
+func keyThumbprint(public crypto.PublicKey) (string, error) {
+	jwk := publicJWK(public)
+
+	var members interface{}
+	switch jwk.KeyType {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.KeyType, jwk.N}
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Curve, jwk.KeyType, jwk.X}
+	default:
+		return "", fmt.Errorf("unsupported key type %T", public)
+	}
+
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// signToken signs claims with the current signing key and sets its kid
+func signToken(claims jwt.Claims) (string, error) {
+	set := keys.Load()
+	if set == nil {
+		return "", ErrNoSigningKey
+	}
+
+	token := jwt.NewWithClaims(set.signing.Method, claims)
+	token.Header["kid"] = set.signing.ID
+	return token.SignedString(set.signingKey)
+}
+
+// verificationKey is the jwt.Keyfunc that picks the key named by the kid
+// header and makes sure the token's algorithm matches that key
+func verificationKey(token *jwt.Token) (interface{}, error) {
+	set := keys.Load()
+	if set == nil {
+		return nil, ErrNoSigningKey
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key, ok := set.verify[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.Public, nil
+}
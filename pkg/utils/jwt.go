@@ -1,23 +1,40 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
-	"os"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-// Secret key for JWT
-var jwtKey = []byte(getJWTSecret())
+// Only asymmetric algorithms are accepted; see jwt-keys.go
+var validSigningMethods = []string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}
 
-func getJWTSecret() string {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		// Default secret - CHANGE THIS IN PRODUCTION!
-		return "your-secret-key-change-this-in-production"
-	}
-	return secret
+// Access tokens are short lived; clients renew them with a refresh token
+const (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// Every token names this API as its issuer, and its audience says what it
+// is for: access tokens are for AudienceAccess, the others for their
+// purpose. A token of one kind is rejected where another is expected.
+const (
+	TokenIssuer    = "mycreativefinancing-api"
+	AudienceAccess = "access"
+)
+
+// Token times are written with microseconds, so that revoking a user's
+// tokens (see models.RevokeUserTokens) also catches the ones issued in the
+// same second
+const TokenTimePrecision = time.Microsecond
+
+func init() {
+	jwt.TimePrecision = TokenTimePrecision
 }
 
 // Claims structure for JWT
@@ -25,40 +42,46 @@ type Claims struct {
 	UserID     uint   `json:"user_id"`
 	Email      string `json:"email"`
 	IsAdmin    bool   `json:"is_admin"`
-	IsEmployee bool   `json:"is_employee"` // Add this line
+	IsEmployee bool   `json:"is_employee"`
+	TwoFactor  bool   `json:"tfa,omitempty"` // the session was started with a second factor
 	jwt.RegisteredClaims
 }
 
-// Generate a new JWT token
-func GenerateToken(userID uint, email string, isAdmin bool, isEmployee bool) (string, error) {
-	// Set expiration time - 24 hours
-	expirationTime := time.Now().Add(24 * time.Hour)
+// Generate a new JWT access token. Every token gets a unique ID (jti) so it
+// can be revoked individually.
+func GenerateToken(userID uint, email string, isAdmin bool, isEmployee bool, twoFactor bool) (string, error) {
+	// Set expiration time
+	expirationTime := time.Now().Add(AccessTokenTTL)
+
+	tokenID, err := GenerateRandomToken(16)
+	if err != nil {
+		return "", err
+	}
 
 	claims := &Claims{
 		UserID:     userID,
 		Email:      email,
 		IsAdmin:    isAdmin,
-		IsEmployee: isEmployee, // Add this line
+		IsEmployee: isEmployee,
+		TwoFactor:  twoFactor,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID,
+			Issuer:    TokenIssuer,
+			Audience:  jwt.ClaimStrings{AudienceAccess},
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtKey)
+	return signToken(claims)
 }
 
 // Parse and validate JWT token
 func ValidateToken(tokenString string) (*Claims, error) {
 	claims := &Claims{}
 
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return jwtKey, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, claims, verificationKey, jwt.WithValidMethods(validSigningMethods),
+		jwt.WithIssuer(TokenIssuer), jwt.WithAudience(AudienceAccess), jwt.WithExpirationRequired())
 
 	if err != nil {
 		return nil, err
@@ -70,3 +93,122 @@ func ValidateToken(tokenString string) (*Claims, error) {
 
 	return claims, nil
 }
+
+// Purposes of single-use action tokens
+const (
+	PurposePasswordReset     = "password-reset"
+	PurposeEmailVerification = "email-verification"
+	PurposeTwoFactorLogin    = "two-factor-login" // second step of a login with 2FA
+)
+
+// ActionClaims structure for single-use tokens that authorize one action,
+// such as resetting a password. The purpose is carried as the audience so
+// a token minted for one action is rejected by every other.
+type ActionClaims struct {
+	UserID uint   `json:"user_id"`
+	Email  string `json:"email"` // the address the token was sent to
+	jwt.RegisteredClaims
+}
+
+// Generate a signed action token for purpose, valid for ttl
+func GenerateActionToken(userID uint, email string, purpose string, ttl time.Duration) (string, error) {
+	tokenID, err := GenerateRandomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	claims := &ActionClaims{
+		UserID: userID,
+		Email:  email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID,
+			Issuer:    TokenIssuer,
+			Audience:  jwt.ClaimStrings{purpose},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	return signToken(claims)
+}
+
+// Parse and validate an action token minted for purpose. Single use is
+// enforced by the caller, using the token ID.
+func ValidateActionToken(tokenString string, purpose string) (*ActionClaims, error) {
+	claims := &ActionClaims{}
+
+	token, err := jwt.ParseWithClaims(tokenString, claims, verificationKey,
+		jwt.WithValidMethods(validSigningMethods), jwt.WithIssuer(TokenIssuer), jwt.WithAudience(purpose), jwt.WithExpirationRequired())
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !token.Valid || claims.ID == "" {
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	return claims, nil
+}
+
+// Purpose of signed document download links
+const PurposeDocumentDownload = "document-download"
+
+// DownloadClaims structure for a short-lived link to one document. Links
+// can be used any number of times until they expire.
+type DownloadClaims struct {
+	DocumentID uint `json:"document_id"`
+	UserID     uint `json:"user_id,omitempty"` // who asked for the link, 0 when anonymous
+	jwt.RegisteredClaims
+}
+
+// Generate a signed download token for a document, valid for ttl
+func GenerateDownloadToken(documentID uint, userID uint, ttl time.Duration) (string, error) {
+	claims := &DownloadClaims{
+		DocumentID: documentID,
+		UserID:     userID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    TokenIssuer,
+			Audience:  jwt.ClaimStrings{PurposeDocumentDownload},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	return signToken(claims)
+}
+
+// Parse and validate a download token
+func ValidateDownloadToken(tokenString string) (*DownloadClaims, error) {
+	claims := &DownloadClaims{}
+
+	token, err := jwt.ParseWithClaims(tokenString, claims, verificationKey,
+		jwt.WithValidMethods(validSigningMethods), jwt.WithIssuer(TokenIssuer), jwt.WithAudience(PurposeDocumentDownload), jwt.WithExpirationRequired())
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !token.Valid || claims.DocumentID == 0 {
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	return claims, nil
+}
+
+// GenerateRandomToken returns n random bytes encoded as URL-safe base64,
+// for use as opaque tokens and identifiers
+func GenerateRandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken returns the SHA-256 hex digest of an opaque token. Only hashes
+// of refresh tokens are stored, so a database leak does not leak sessions.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+)
+
+// useTestSigningKey signs tokens with a fresh Ed25519 key for the test
+func useTestSigningKey(t *testing.T) {
+	t.Helper()
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set, err := newJWTKeySet(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previous := keys.Swap(set)
+	t.Cleanup(func() { keys.Store(previous) })
+}
+
+func TestAccessTokenIssuedAtPrecision(t *testing.T) {
+	useTestSigningKey(t)
+
+	before := time.Now()
+	token, err := GenerateToken(7, "jane@example.com", false, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := time.Now()
+
+	claims, err := ValidateToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.IssuedAt == nil {
+		t.Fatal("token has no iat")
+	}
+
+	// Revocation compares against iat, so it must not be cut to the second.
+	// Parsing the decimal may lose up to one microsecond.
+	issuedAt := claims.IssuedAt.Time
+	if issuedAt.Before(before.Truncate(TokenTimePrecision).Add(-TokenTimePrecision)) || issuedAt.After(after) {
+		t.Errorf("iat = %s, want between %s and %s", issuedAt.Format(time.RFC3339Nano), before.Format(time.RFC3339Nano), after.Format(time.RFC3339Nano))
+	}
+}
+
+func TestActionTokenIsNotAnAccessToken(t *testing.T) {
+	useTestSigningKey(t)
+
+	token, err := GenerateActionToken(7, "jane@example.com", PurposePasswordReset, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateToken(token); err == nil {
+		t.Error("ValidateToken accepted a password reset token")
+	}
+	if _, err := ValidateActionToken(token, PurposePasswordReset); err != nil {
+		t.Errorf("ValidateActionToken: %v", err)
+	}
+}
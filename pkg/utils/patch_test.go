@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		patch    string
+		want     string
+	}{
+		// RFC 7396 appendix A
+		{"replace a member", `{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{"add a member", `{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{"null deletes a member", `{"a":"b"}`, `{"a":null}`, `{}`},
+		{"null deletes only that member", `{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{"array replaces a string", `{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{"string replaces an array", `{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{"nested objects merge", `{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{"arrays are replaced wholesale", `{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{"non-object patch replaces an array", `["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{"array patch replaces an object", `{"a":"b"}`, `["c"]`, `["c"]`},
+		{"null patch replaces the document", `{"a":"foo"}`, `null`, `null`},
+		{"string patch replaces the document", `{"a":"foo"}`, `"bar"`, `"bar"`},
+		{"null in the document is kept", `{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{"object patch replaces an array", `[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{"null inside a new nested object", `{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+
+		// Property documents
+		{"null inside a nested object", `{"address":"1 Main St","price_history":{"2020":100000,"2021":120000}}`,
+			`{"price_history":{"2020":null}}`, `{"address":"1 Main St","price_history":{"2021":120000}}`},
+		{"empty patch changes nothing", `{"price":100000,"images":["a.jpg"]}`, `{}`, `{"price":100000,"images":["a.jpg"]}`},
+		{"images replaced wholesale", `{"images":["a.jpg","b.jpg"]}`, `{"images":["c.jpg"]}`, `{"images":["c.jpg"]}`},
+	}
+
+	for _, tt := range tests {
+		got, err := MergePatch([]byte(tt.document), []byte(tt.patch))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+
+		var gotValue, wantValue interface{}
+		if err := json.Unmarshal(got, &gotValue); err != nil {
+			t.Fatalf("%s: result is not JSON: %s", tt.name, got)
+		}
+		if err := json.Unmarshal([]byte(tt.want), &wantValue); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(gotValue, wantValue) {
+			t.Errorf("%s: MergePatch(%s, %s) = %s, want %s", tt.name, tt.document, tt.patch, got, tt.want)
+		}
+	}
+}
+
+func TestMergePatchInvalid(t *testing.T) {
+	if _, err := MergePatch([]byte(`{"a":`), []byte(`{}`)); err == nil {
+		t.Error("MergePatch accepted an invalid document")
+	}
+	if _, err := MergePatch([]byte(`{}`), []byte(`{"a":}`)); err == nil {
+		t.Error("MergePatch accepted an invalid patch")
+	}
+}
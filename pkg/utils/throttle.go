@@ -0,0 +1,198 @@
+package utils
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Throttle tracks failed attempts per key (e.g. client IP) in memory and
+// imposes an exponentially growing wait once a key has failed Threshold
+// times: Base after the Threshold-th failure, doubling up to Max. With a
+// lockout, LockAfter failures in a row lock the key for LockFor.
+type Throttle struct {
+	Threshold int
+	Base      time.Duration
+	Max       time.Duration
+	LockAfter int
+	LockFor   time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*throttleEntry
+	swept   time.Time
+}
+
+type throttleEntry struct {
+	failures    int
+	last        time.Time
+	lockedUntil time.Time
+}
+
+func NewThrottle(threshold int, base time.Duration, max time.Duration) *Throttle {
+	return &Throttle{
+		Threshold: threshold,
+		Base:      base,
+		Max:       max,
+		entries:   map[string]*throttleEntry{},
+	}
+}
+
+// WithLockout makes after failures in a row lock a key for duration
+func (t *Throttle) WithLockout(after int, duration time.Duration) *Throttle {
+	t.LockAfter = after
+	t.LockFor = duration
+	return t
+}
+
+// RetryAfter returns how long key has to wait before its next attempt, or 0
+func (t *Throttle) RetryAfter(key string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry, ok := t.entries[key]
+	if !ok {
+		return 0
+	}
+	if locked := time.Until(entry.lockedUntil); locked > 0 {
+		return locked
+	}
+	return remaining(entry.last, Backoff(entry.failures, t.Threshold, t.Base, t.Max))
+}
+
+// Fail records a failed attempt for key
+func (t *Throttle) Fail(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.sweep()
+
+	entry, ok := t.entries[key]
+	if !ok {
+		entry = &throttleEntry{}
+		t.entries[key] = entry
+	}
+	entry.failures++
+	entry.last = time.Now()
+
+	if t.LockAfter > 0 && entry.failures >= t.LockAfter {
+		entry.lockedUntil = entry.last.Add(t.LockFor)
+		entry.failures = 0
+	}
+}
+
+// Reset forgets the failures of key, e.g. after a successful attempt
+func (t *Throttle) Reset(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.entries, key)
+}
+
+// sweep drops entries that have been quiet for longer than the longest
+// wait, so the map does not grow without bound. Runs at most once a minute.
+func (t *Throttle) sweep() {
+	now := time.Now()
+	if now.Sub(t.swept) < time.Minute {
+		return
+	}
+	t.swept = now
+
+	for key, entry := range t.entries {
+		if now.Sub(entry.last) > 2*t.Max && now.After(entry.lockedUntil) {
+			delete(t.entries, key)
+		}
+	}
+}
+
+// Backoff returns the wait imposed after failures consecutive failures:
+// nothing below threshold, then base doubling with every further failure,
+// capped at max
+func Backoff(failures int, threshold int, base time.Duration, max time.Duration) time.Duration {
+	if failures < threshold {
+		return 0
+	}
+	wait := float64(base) * math.Pow(2, float64(failures-threshold))
+	if wait > float64(max) {
+		return max
+	}
+	return time.Duration(wait)
+}
+
+func remaining(last time.Time, wait time.Duration) time.Duration {
+	if left := time.Until(last.Add(wait)); left > 0 {
+		return left
+	}
+	return 0
+}
+
+// ClientIP returns the address of the client that made the request. The
+// X-Forwarded-For header is only trusted when TRUST_PROXY_HEADERS=true,
+// i.e. when the API runs behind a proxy that sets it. Clients can send the
+// header themselves, so only the entries proxies appended count: the
+// rightmost one, which the proxy in front of the API added, or further left
+// past proxies listed in TRUSTED_PROXIES (IPs or CIDRs, comma separated).
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	if os.Getenv("TRUST_PROXY_HEADERS") != "true" {
+		return host
+	}
+
+	var chain []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for _, entry := range strings.Split(header, ",") {
+			if entry = strings.TrimSpace(entry); entry != "" {
+				chain = append(chain, entry)
+			}
+		}
+	}
+
+	trusted := trustedProxies()
+	for i := len(chain) - 1; i >= 0; i-- {
+		if i == 0 || !isTrustedProxy(chain[i], trusted) {
+			return chain[i]
+		}
+	}
+	return host
+}
+
+// trustedProxies parses TRUSTED_PROXIES
+func trustedProxies() []*net.IPNet {
+	var networks []*net.IPNet
+	for _, entry := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			networks = append(networks, network)
+		}
+	}
+	return networks
+}
+
+func isTrustedProxy(address string, trusted []*net.IPNet) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, network := range trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,140 @@
+package utils
+
+import (
+	"encoding/base32"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The SHA-1 secret of the RFC 6238 test vectors, "12345678901234567890"
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	// RFC 6238 appendix B lists 8-digit codes; 6-digit codes are their last
+	// six digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		got, err := TOTPCode(rfcSecret, TOTPStep(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("TOTPCode at %d: %v", tt.unix, err)
+		}
+		if got != tt.code {
+			t.Errorf("TOTPCode at %d = %s, want %s", tt.unix, got, tt.code)
+		}
+	}
+}
+
+func TestTOTPCodeInvalidSecret(t *testing.T) {
+	if _, err := TOTPCode("not base32!", 1); err == nil {
+		t.Error("TOTPCode accepted an invalid secret")
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := TOTPStep(now)
+
+	code := func(step int64) string {
+		c, err := TOTPCode(rfcSecret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name     string
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current step", code(current), current, true},
+		{"previous step, clock drift", code(current - 1), current - 1, true},
+		{"next step, clock drift", code(current + 1), current + 1, true},
+		{"two steps back", code(current - 2), 0, false},
+		{"two steps ahead", code(current + 2), 0, false},
+		{"spaces are ignored", code(current)[:3] + " " + code(current)[3:], current, true},
+		{"surrounding whitespace", " " + code(current) + "\n", current, true},
+		{"too short", code(current)[:5], 0, false},
+		{"too long", code(current) + "0", 0, false},
+		{"empty", "", 0, false},
+		{"wrong code", "000000", 0, false}, // no step near now has this code
+	}
+
+	for _, tt := range tests {
+		step, ok := VerifyTOTP(rfcSecret, tt.code, now)
+		if ok != tt.wantOK || step != tt.wantStep {
+			t.Errorf("%s: VerifyTOTP(%q) = %d, %v, want %d, %v", tt.name, tt.code, step, ok, tt.wantStep, tt.wantOK)
+		}
+	}
+}
+
+func TestVerifyTOTPLowercaseSecret(t *testing.T) {
+	now := time.Unix(59, 0)
+	if _, ok := VerifyTOTP(strings.ToLower(rfcSecret), "287082", now); !ok {
+		t.Error("VerifyTOTP rejected a lowercase secret")
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	a, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a == b {
+		t.Error("GenerateTOTPSecret returned the same secret twice")
+	}
+	// 160 bits in unpadded base32
+	if len(a) != 32 || strings.Contains(a, "=") {
+		t.Errorf("GenerateTOTPSecret = %q, want 32 unpadded base32 characters", a)
+	}
+	if _, err := TOTPCode(a, 1); err != nil {
+		t.Errorf("generated secret is not usable: %v", err)
+	}
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	uri := TOTPProvisioningURI("MyCreativeFinancing", "jane@example.com", "JBSWY3DPEHPK3PXP")
+
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Scheme != "otpauth" || parsed.Host != "totp" {
+		t.Errorf("unexpected URI %s", uri)
+	}
+	if parsed.Path != "/MyCreativeFinancing:jane@example.com" {
+		t.Errorf("label = %q", parsed.Path)
+	}
+
+	query := parsed.Query()
+	want := map[string]string{
+		"secret":    "JBSWY3DPEHPK3PXP",
+		"issuer":    "MyCreativeFinancing",
+		"algorithm": "SHA1",
+		"digits":    "6",
+		"period":    "30",
+	}
+	for key, value := range want {
+		if got := query.Get(key); got != value {
+			t.Errorf("%s = %q, want %q", key, got, value)
+		}
+	}
+}
@@ -13,3 +13,16 @@ func ParseBody(r *http.Request, x interface{}) {
 		}
 	}
 }
+
+// RespondJSON writes v as a JSON response with the given status code
+func RespondJSON(w http.ResponseWriter, status int, v interface{}) {
+	res, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, "Failed to encode response as JSON", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(res)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"api/pkg/address"
+	"api/pkg/config"
+	"api/pkg/models"
+
+	"gorm.io/gorm"
+)
+
+// Backfills the structured address columns (street, unit, city, state, zip,
+// county) and coordinates of existing properties.
+//
+//	go run ./scripts/backfill-addresses [-geocode=false] [-force] [-dry-run]
+//
+// Uses the same MYSQL_* environment as the API. Geocoding requires
+// REAL_ESTATE_API_KEY.
+func main() {
+	geocode := flag.Bool("geocode", true, "look up coordinates for properties without them")
+	force := flag.Bool("force", false, "re-geocode properties that already have coordinates")
+	dryRun := flag.Bool("dry-run", false, "print the changes without saving them")
+	batchSize := flag.Int("batch", 100, "number of properties loaded per batch")
+	flag.Parse()
+
+	var geocoder address.Geocoder
+	if *geocode {
+		geocoder = address.DefaultGeocoder()
+		if geocoder == nil {
+			fmt.Println("REAL_ESTATE_API_KEY is not set, run with -geocode=false to only parse addresses")
+			os.Exit(1)
+		}
+	}
+
+	db := config.GetDB()
+
+	processed, failed := 0, 0
+	var batch []models.Property
+	result := db.FindInBatches(&batch, *batchSize, func(tx *gorm.DB, _ int) error {
+		for i := range batch {
+			property := &batch[i]
+			processed++
+
+			// With -force the stored coordinates are cleared so they are looked
+			// up again, and put back if the lookup fails
+			latitude, longitude := property.Latitude, property.Longitude
+			if *force {
+				property.Latitude = nil
+				property.Longitude = nil
+			}
+			hadCoordinates := property.Latitude != nil && property.Longitude != nil
+
+			if err := property.NormalizeAddress(geocoder); err != nil {
+				property.Latitude, property.Longitude = latitude, longitude
+				fmt.Printf("✗ [%d] %s: %v\n", property.ID, property.Address, err)
+				failed++
+			} else {
+				fmt.Printf("✓ [%d] %s → %s | %s | %s %s\n", property.ID, property.Address,
+					value(property.Street), value(property.City), value(property.State), value(property.Zip))
+			}
+
+			if !*dryRun {
+				if err := db.Model(property).Select("street", "unit", "city", "state", "zip", "county", "latitude", "longitude").Updates(property).Error; err != nil {
+					fmt.Printf("✗ [%d] failed to save: %v\n", property.ID, err)
+					failed++
+				}
+			}
+
+			// Stay under the geocoding API's rate limit
+			if geocoder != nil && !hadCoordinates {
+				time.Sleep(1 * time.Second)
+			}
+		}
+		return nil
+	})
+
+	fmt.Println(strings.Repeat("=", 80))
+	if result.Error != nil {
+		fmt.Println("Backfill aborted:", result.Error)
+		os.Exit(1)
+	}
+	fmt.Printf("Processed %d properties, %d failures", processed, failed)
+	if *dryRun {
+		fmt.Print(" (dry run, nothing saved)")
+	}
+	fmt.Println()
+
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func value(s *string) string {
+	if s == nil {
+		return "-"
+	}
+	return *s
+}
@@ -10,6 +10,8 @@ import (
 	"os"
 	"strings"
 	"time"
+
+	"api/pkg/address"
 )
 
 // ============================================================================
@@ -27,6 +29,10 @@ const (
 	FORCE_UPDATE = false
 )
 
+// Updates go through the protected API: export API_KEY with a key holding
+// the properties:update scope (POST /api/admin/api-keys) before running
+// this script.
+
 // ============================================================================
 // Logger with timestamps
 // ============================================================================
@@ -65,50 +71,12 @@ var logger = NewLogger()
 // ============================================================================
 // Data Structures
 // ============================================================================
+// Only the fields this script reads; updates are sent as a JSON Merge Patch
+// so the rest of the property is left untouched
 type Property struct {
-	ID                     uint     `json:"ID"`
-	CreatedAt              string   `json:"CreatedAt,omitempty"`
-	UpdatedAt              string   `json:"UpdatedAt,omitempty"`
-	DeletedAt              *string  `json:"DeletedAt,omitempty"`
-	Address                string   `json:"address"`
-	Price                  *float64 `json:"price"`
-	Description            *string  `json:"description"`
-	Images                 *string  `json:"images"`
-	Sold                   *bool    `json:"sold"`
-	Bedrooms               *int     `json:"bedrooms"`
-	Bathrooms              *float64 `json:"bathrooms"`
-	RentZestimate          *float64 `json:"rent_zestimate"`
-	Zestimate              *float64 `json:"zestimate"`
-	PropertyType           *string  `json:"property_type"`
-	Zoning                 *string  `json:"zoning"`
-	YearBuilt              *int     `json:"year_built"`
-	LotSize                *int     `json:"lot_size"`
-	PricePerSquareFoot     *float64 `json:"price_per_square_foot"`
-	LivingArea             *int     `json:"living_area"`
-	PurchasePrice          *float64 `json:"purchase_price"`
-	BalanceToClose         *float64 `json:"balance_to_close"`
-	MonthlyHoldingCost     *float64 `json:"monthly_holding_cost"`
-	InterestRate           *float64 `json:"interest_rate"`
-	NearbyHospitals        *string  `json:"nearby_hospitals"`
-	NearbySchools          *string  `json:"nearby_schools"`
-	NearbyHomes            *string  `json:"nearby_homes"`
-	PriceHistory           *string  `json:"price_history"`
-	TaxHistory             *string  `json:"tax_history"`
-	ContactRecipients      *string  `json:"contact_recipients"`
-	MonthlyHoaFee          *int     `json:"monthly_hoa_fee"`
-	TransactionDocumentUrl string   `json:"transaction_document_url"`
-	BenefitSheetUrl        string   `json:"benefit_sheet_url"`
-	Escrow                 *float64 `json:"escrow"`
-	DealHolder             *string  `json:"deal_holder"`
-	DealHolderPhone        *string  `json:"deal_holder_phone"`
-	DealHolderEmail        *string  `json:"deal_holder_email"`
-	AssignmentFee          *float64 `json:"assignment_fee"`
-	InHouseDeal            *bool    `json:"in_house_deal"`
-	RentalRestriction      *bool    `json:"rental_restriction"`
-	PriceBreakDown         *string  `json:"price_breakdown"`
-	AdditionalBenefits     *string  `json:"additional_benefits"`
-	CreatedBy              *string  `json:"created_by"`
-	ReApiId                *string  `json:"re_api_id"`
+	ID      uint    `json:"ID"`
+	Address string  `json:"address"`
+	ReApiId *string `json:"re_api_id"`
 }
 
 type PropertiesResponse struct {
@@ -145,9 +113,9 @@ type RealEstateAPIResponse struct {
 
 // Parse address to get just street + city for better API results
 func parseAddressForSearch(fullAddress string) string {
-	parts := strings.Split(fullAddress, ",")
-	if len(parts) >= 2 {
-		return strings.TrimSpace(parts[0]) + ", " + strings.TrimSpace(parts[1])
+	components := address.Parse(fullAddress)
+	if components.Street != "" && components.City != "" {
+		return components.StreetLine() + ", " + components.City
 	}
 	return fullAddress
 }
@@ -239,13 +207,12 @@ func fetchAllProperties() ([]Property, error) {
 
 // Update property with new re_api_id
 func updateProperty(property Property, reApiId string) error {
-	url := fmt.Sprintf("%s/properties/%d", API_BASE_URL, property.ID)
+	url := fmt.Sprintf("%s/api/properties/%d", API_BASE_URL, property.ID)
 
 	oldId := "null"
 	if property.ReApiId != nil && *property.ReApiId != "" {
 		oldId = *property.ReApiId
 	}
-	property.ReApiId = &reApiId
 
 	if oldId != "null" {
 		logger.Info("  → Updating: %s → %s", oldId, reApiId)
@@ -253,17 +220,18 @@ func updateProperty(property Property, reApiId string) error {
 		logger.Info("  → Setting: %s", reApiId)
 	}
 
-	jsonData, err := json.Marshal(property)
+	jsonData, err := json.Marshal(map[string]string{"re_api_id": reApiId})
 	if err != nil {
-		return fmt.Errorf("failed to marshal property: %v", err)
+		return fmt.Errorf("failed to marshal patch: %v", err)
 	}
 
-	req, err := http.NewRequest("PUT", url, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequest("PATCH", url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %v", err)
 	}
 
-	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	req.Header.Set("X-API-Key", os.Getenv("API_KEY"))
 
 	client := &http.Client{Timeout: 15 * time.Second}
 	resp, err := client.Do(req)
@@ -300,6 +268,11 @@ func main() {
 	logger.Info("  - Force Update: %v", FORCE_UPDATE)
 	fmt.Println()
 
+	if os.Getenv("API_KEY") == "" {
+		logger.Error("FATAL: API_KEY is not set")
+		os.Exit(1)
+	}
+
 	// Fetch all properties
 	logger.Info("📥 Fetching properties...")
 	properties, err := fetchAllProperties()